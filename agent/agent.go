@@ -0,0 +1,493 @@
+// Package agent keeps OATH sessions and access keys of password protected
+// keys in a background process, similar to ssh-agent.
+//
+// The agent serves clients over a Unix socket, accepting only connections of
+// allowed users (by default the user running the agent, verified with the
+// peer credentials of the socket). It answers "SELECT" itself, so clients
+// never see the challenge of an unlocked key, and relays "LIST", "CALCULATE"
+// and "CALCULATE ALL" to its session. The client is a ykoath.Transport, so
+// ykoath.NewWithTransport turns it into a regular OATH session:
+//
+//	client, _ := agent.Dial(os.Getenv(agent.EnvSocket))
+//	oath := ykoath.NewWithTransport(client)
+//	code, _ := oath.Calculate("github", touchRequiredCallback)
+//
+// Access keys are added with Client.AddPassword and forgotten (and the session
+// closed) once their lifetime expired.
+package agent
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+	"github.com/yawn/ykoath/internal/wire"
+)
+
+// EnvSocket is the environment variable holding the socket path of a running
+// agent
+const EnvSocket = "YKOATH_AGENT_SOCK"
+
+const (
+	frameAPDU     = 0x00
+	frameAddKey   = 0x01
+	frameLock     = 0x02
+	frameResponse = 0x00
+	frameError    = 0x01
+)
+
+const (
+	errAgent           = "agent error: %s"
+	errEmptyFrame      = "empty frame"
+	errFailedToOpen    = "failed to open session"
+	errFailedToUnlock  = "failed to unlock session"
+	errFrameType       = "unknown frame type (%x)"
+	errNotSocket       = "%s exists and is not a socket"
+	errNotUnix         = "not a Unix socket connection"
+	errPeerNotAllowed  = "peer uid %d is not allowed"
+	errSocketInUse     = "socket %s is in use by a running agent"
+	errUnsupportedPeer = "peer credentials are not supported on this platform"
+)
+
+var (
+
+	// statusAuthRequired is returned while the agent holds no access key for
+	// a password protected key
+	statusAuthRequired = []byte{0x69, 0x82}
+
+	// statusDenied is returned for APDUs the agent does not relay
+	// ("instruction not supported")
+	statusDenied = []byte{0x6d, 0x00}
+
+	// statusSuccess terminates synthesized responses
+	statusSuccess = []byte{0x90, 0x00}
+)
+
+// Agent holds an OATH session and the access key unlocking it
+type Agent struct {
+
+	// Allow decides if a peer (by user id) may connect; nil allows the user
+	// running the agent only
+	Allow func(uid int) bool
+
+	Debug func(string, ...interface{})
+
+	// Lifetime is the duration after which an added access key is forgotten
+	// and the session it unlocked is closed; zero keeps it until Lock is
+	// called
+	Lifetime time.Duration
+
+	expiry     *time.Timer
+	generation uint64
+	key        []byte
+	mu         sync.Mutex
+	open       func() (*ykoath.OATH, error)
+	selected   *ykoath.Select
+	session    *ykoath.OATH
+}
+
+// New creates an agent opening its session on demand
+func New(open func() (*ykoath.OATH, error)) *Agent {
+
+	return &Agent{
+		open: open,
+	}
+
+}
+
+// Listen creates a Unix socket only accessible by the current user, replacing
+// a stale socket at the same path (but no other file). The socket should be
+// created in a directory only accessible by the current user as well.
+func Listen(path string) (net.Listener, error) {
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errors.Errorf(errSocketInUse, path)
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf(errNotSocket, path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+
+	}
+
+	l, err := net.Listen("unix", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+
+}
+
+// Serve accepts connections on the listener and serves each of them in its own
+// goroutine, until the listener is closed
+func (a *Agent) Serve(l net.Listener) error {
+
+	for {
+
+		conn, err := l.Accept()
+
+		if err != nil {
+			return err
+		}
+
+		go a.serve(conn)
+
+	}
+
+}
+
+// AddKey adds an access key (see ykoath.DeriveKey), verifying it if the device
+// is password protected
+func (a *Agent) AddKey(key []byte) error {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.addKey(key)
+
+}
+
+// AddPassword derives the access key of a password and adds it
+func (a *Agent) AddPassword(password []byte) error {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.addPassword(password)
+
+}
+
+// Lock forgets the access key and closes the session
+func (a *Agent) Lock() {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.lock()
+
+}
+
+// serve answers the frames of a single connection from an allowed peer. The
+// session is locked per frame.
+func (a *Agent) serve(conn net.Conn) {
+
+	defer conn.Close()
+
+	if err := a.allowed(conn); err != nil {
+		a.debug("DENY %v", err)
+		return
+	}
+
+	for {
+
+		req, err := wire.ReadFrame(conn)
+
+		if err != nil || len(req) == 0 {
+			return
+		}
+
+		a.mu.Lock()
+
+		var res []byte
+
+		switch req[0] {
+		case frameAPDU:
+			res, err = a.relay(req[1:])
+		case frameAddKey:
+			err = a.addPassword(req[1:])
+		case frameLock:
+			a.lock()
+		default:
+			err = errors.Errorf(errFrameType, req[0])
+		}
+
+		a.mu.Unlock()
+
+		if err != nil {
+			err = wire.WriteFrame(conn, []byte{frameError}, []byte(err.Error()))
+		} else {
+			err = wire.WriteFrame(conn, []byte{frameResponse}, res)
+		}
+
+		if err != nil {
+			return
+		}
+
+	}
+
+}
+
+// allowed checks the peer credentials of a connection
+func (a *Agent) allowed(conn net.Conn) error {
+
+	uc, ok := conn.(*net.UnixConn)
+
+	if !ok {
+		return errors.New(errNotUnix)
+	}
+
+	uid, err := peerUID(uc)
+
+	if err != nil {
+		return err
+	}
+
+	if a.Allow != nil && a.Allow(uid) || a.Allow == nil && uid == os.Getuid() {
+		return nil
+	}
+
+	return errors.Errorf(errPeerNotAllowed, uid)
+
+}
+
+// relay answers "SELECT" from the session and forwards the allowed
+// instructions (fetching chained responses as a whole), reopening the session
+// once if it was lost
+func (a *Agent) relay(apdu []byte) ([]byte, error) {
+
+	if len(apdu) < 4 {
+		return statusDenied, nil
+	}
+
+	// SELECT shares its instruction with CALCULATE ALL
+	if apdu[1] == 0xa4 && apdu[2] == 0x04 {
+
+		s, err := a.ensure()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return encodeSelect(s), nil
+
+	}
+
+	switch apdu[1] {
+	case 0xa1, 0xa2, 0xa4:
+	default:
+		a.debug("DENY % x", apdu)
+		return statusDenied, nil
+	}
+
+	for retry := 0; ; retry++ {
+
+		s, err := a.ensure()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if s.IsLocked() {
+			return statusAuthRequired, nil
+		}
+
+		a.debug("RELAY % x", apdu)
+
+		res, err := wire.Transmit(a.session, apdu)
+
+		// another application may have reset the card (locking it again) or
+		// the key may have been unplugged
+		if retry == 0 && (err != nil || bytes.HasSuffix(res, statusAuthRequired)) {
+			a.debug("LOST %v", err)
+			a.close()
+			continue
+		}
+
+		return res, err
+
+	}
+
+}
+
+// ensure opens, selects and unlocks a session if there is none, returning the
+// result of "SELECT" (with a challenge if the agent cannot unlock it)
+func (a *Agent) ensure() (*ykoath.Select, error) {
+
+	if a.session != nil {
+		return a.selected, nil
+	}
+
+	session, err := a.open()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToOpen)
+	}
+
+	s, err := session.Select()
+
+	if err != nil {
+		session.Close()
+		return nil, errors.Wrapf(err, errFailedToOpen)
+	}
+
+	if s.IsLocked() && a.key != nil {
+
+		if err := session.UnlockWithKey(a.key); err != nil {
+			session.Close()
+			return nil, errors.Wrapf(err, errFailedToUnlock)
+		}
+
+		s.Algorithm, s.Challenge = nil, nil
+
+	}
+
+	a.session = session
+	a.selected = s
+
+	return s, nil
+
+}
+
+// addPassword derives the access key of a password with the salt of the
+// device and adds it
+func (a *Agent) addPassword(password []byte) error {
+
+	s, err := a.ensure()
+
+	if err != nil {
+		return err
+	}
+
+	return a.addKey(ykoath.DeriveKey(s.Name, password))
+
+}
+
+// addKey unlocks the session with an access key and keeps the key for the
+// configured lifetime
+func (a *Agent) addKey(key []byte) error {
+
+	s, err := a.ensure()
+
+	if err != nil {
+		return err
+	}
+
+	if s.IsLocked() {
+
+		if err := a.session.UnlockWithKey(key); err != nil {
+			return err
+		}
+
+		s.Algorithm, s.Challenge = nil, nil
+
+	}
+
+	a.forget()
+	a.key = append([]byte(nil), key...)
+
+	if a.Lifetime > 0 {
+
+		generation := a.generation
+
+		a.expiry = time.AfterFunc(a.Lifetime, func() {
+			a.expire(generation)
+		})
+
+	}
+
+	return nil
+
+}
+
+// expire locks the agent unless the access key of the given generation has
+// been forgotten since, as a timer that already fired cannot be stopped
+func (a *Agent) expire(generation uint64) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if generation == a.generation {
+		a.lock()
+	}
+
+}
+
+// lock forgets the access key and closes the session
+func (a *Agent) lock() {
+
+	a.forget()
+	a.close()
+
+}
+
+// forget zeroes and drops the access key
+func (a *Agent) forget() {
+
+	if a.expiry != nil {
+		a.expiry.Stop()
+		a.expiry = nil
+	}
+
+	a.generation++
+
+	for idx := range a.key {
+		a.key[idx] = 0
+	}
+
+	a.key = nil
+
+}
+
+// close closes the session
+func (a *Agent) close() {
+
+	if a.session != nil {
+		a.session.Close()
+	}
+
+	a.selected = nil
+	a.session = nil
+
+}
+
+// debug logs if a debugger is set
+func (a *Agent) debug(format string, args ...interface{}) {
+
+	if a.Debug != nil {
+		a.Debug(format, args...)
+	}
+
+}
+
+// encodeSelect encodes the response to "SELECT"
+func encodeSelect(s *ykoath.Select) []byte {
+
+	var res []byte
+
+	for _, tv := range []struct {
+		tag   byte
+		value []byte
+	}{
+		{0x79, s.Version},
+		{0x71, s.Name},
+		{0x74, s.Challenge},
+		{0x7b, s.Algorithm},
+	} {
+
+		if len(tv.value) > 0 {
+			res = append(append(res, tv.tag, byte(len(tv.value))), tv.value...)
+		}
+
+	}
+
+	return append(res, statusSuccess...)
+
+}
@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+)
+
+var (
+	testChallenge = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	testSalt      = []byte{0xca, 0xfe, 0xca, 0xfe, 0xca, 0xfe, 0xca, 0xfe}
+)
+
+// testDevice emulates a password protected key holding a single credential
+type testDevice struct {
+	key      []byte
+	mu       sync.Mutex
+	unlocked bool
+}
+
+func (d *testDevice) Transmit(apdu []byte) ([]byte, error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var tlvs = make(map[byte][]byte)
+
+	if len(apdu) > 5 {
+
+		for data := apdu[5:]; len(data) >= 2 && len(data) >= 2+int(data[1]); data = data[2+int(data[1]):] {
+			tlvs[data[0]] = data[2 : 2+int(data[1])]
+		}
+
+	}
+
+	switch {
+	case apdu[1] == 0xa4 && apdu[2] == 0x04:
+
+		d.unlocked = false
+
+		res := []byte{0x79, 0x03, 0x05, 0x04, 0x03, 0x71, byte(len(testSalt))}
+		res = append(res, testSalt...)
+		res = append(append(res, 0x74, byte(len(testChallenge))), testChallenge...)
+
+		return append(res, 0x7b, 0x01, 0x01, 0x90, 0x00), nil
+
+	case apdu[1] == 0xa3:
+
+		if !hmac.Equal(tlvs[0x75], mac(d.key, testChallenge)) {
+			return []byte{0x6a, 0x80}, nil
+		}
+
+		d.unlocked = true
+
+		return append(append([]byte{0x75, 0x14}, mac(d.key, tlvs[0x74])...), 0x90, 0x00), nil
+
+	case !d.unlocked:
+		return []byte{0x69, 0x82}, nil
+
+	case apdu[1] == 0xa1:
+		return append([]byte{0x72, 0x07, 0x21}, append([]byte("github"), 0x90, 0x00)...), nil
+
+	case apdu[1] == 0xa4:
+		return append(append([]byte{0x71, 0x06}, "github"...), 0x76, 0x05, 0x06, 0x00, 0x01, 0xe2, 0x40, 0x90, 0x00), nil
+
+	case apdu[1] == 0xa2:
+		return []byte{0x76, 0x05, 0x06, 0x00, 0x01, 0xe2, 0x40, 0x90, 0x00}, nil
+
+	}
+
+	return []byte{0x6d, 0x00}, nil
+
+}
+
+func (d *testDevice) Close() error {
+	return nil
+}
+
+func mac(key, message []byte) []byte {
+
+	h := hmac.New(sha1.New, key)
+	h.Write(message)
+
+	return h.Sum(nil)
+
+}
+
+// serve starts an agent, returning its socket path
+func serve(t *testing.T, a *Agent) string {
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+
+	l, err := Listen(path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { l.Close() })
+
+	go a.Serve(l)
+
+	return path
+
+}
+
+// testAgent returns an agent for a test device and the number of sessions it
+// opened
+func testAgent() (*Agent, *int) {
+
+	var (
+		device = &testDevice{key: ykoath.DeriveKey(testSalt, []byte("secret"))}
+		opened = new(int)
+	)
+
+	return New(func() (*ykoath.OATH, error) {
+		*opened++
+		return ykoath.NewWithTransport(device), nil
+	}), opened
+
+}
+
+func TestAgent(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		a, opened = testAgent()
+		path      = serve(t, a)
+	)
+
+	client, err := Dial(path)
+	require.NoError(err)
+
+	defer client.Close()
+
+	oath := ykoath.NewWithTransport(client)
+
+	s, err := oath.Select()
+	require.NoError(err)
+	assert.True(s.IsLocked())
+
+	_, err = oath.List()
+	sw, _ := ykoath.StatusWord(err)
+	assert.Equal(ykoath.StatusAuthRequired, sw)
+
+	assert.Error(client.AddPassword([]byte("wrong")))
+	require.NoError(client.AddPassword([]byte("secret")))
+
+	s, err = oath.Select()
+	require.NoError(err)
+	assert.False(s.IsLocked())
+	assert.Equal([]byte{5, 4, 3}, s.Version)
+	assert.Equal(testSalt, s.Name)
+
+	code, err := oath.Calculate("git", nil)
+	require.NoError(err)
+	assert.Equal("123456", code)
+
+	// another client uses the same session without unlocking
+	other, err := Dial(path)
+	require.NoError(err)
+
+	defer other.Close()
+
+	names, err := ykoath.NewWithTransport(other).List()
+	require.NoError(err)
+	assert.Equal("github", names[0].Name)
+	assert.Equal(1, *opened)
+
+	// instructions changing the device are not relayed
+	res, err := client.Transmit([]byte{0x00, 0x04, 0xde, 0xad})
+	require.NoError(err)
+	assert.Equal([]byte{0x6d, 0x00}, res)
+
+	require.NoError(client.Lock())
+
+	s, err = oath.Select()
+	require.NoError(err)
+	assert.True(s.IsLocked())
+	assert.Equal(2, *opened)
+
+}
+
+func TestAgentLifetime(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		a, _    = testAgent()
+	)
+
+	a.Lifetime = 50 * time.Millisecond
+
+	require.NoError(a.AddPassword([]byte("secret")))
+
+	client, err := Dial(serve(t, a))
+	require.NoError(err)
+
+	defer client.Close()
+
+	oath := ykoath.NewWithTransport(client)
+
+	_, err = oath.List()
+	assert.NoError(err)
+
+	assert.Eventually(func() bool {
+		s, err := oath.Select()
+		return err == nil && s.IsLocked()
+	}, time.Second, 10*time.Millisecond)
+
+}
+
+func TestAgentLifetimeReplaced(t *testing.T) {
+
+	var (
+		require = require.New(t)
+		a, _    = testAgent()
+	)
+
+	a.Lifetime = 20 * time.Millisecond
+
+	require.NoError(a.AddPassword([]byte("secret")))
+
+	// the timer of the first key fires while the second one is added
+	a.mu.Lock()
+	time.Sleep(50 * time.Millisecond)
+
+	a.Lifetime = time.Hour
+	require.NoError(a.addPassword([]byte("secret")))
+
+	a.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	require.NotNil(a.key)
+	a.lock()
+
+}
+
+func TestAgentPeerCredentials(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		a, _    = testAgent()
+		peers   = make(chan int, 1)
+	)
+
+	a.Allow = func(uid int) bool {
+		peers <- uid
+		return false
+	}
+
+	client, err := Dial(serve(t, a))
+	require.NoError(err)
+
+	defer client.Close()
+
+	_, err = client.Transmit([]byte{0x00, 0xa1, 0x00, 0x00})
+	assert.Error(err)
+	assert.Equal(os.Getuid(), <-peers)
+
+	_, err = Listen(filepath.Join(t.TempDir(), "missing", "agent.sock"))
+	assert.Error(err)
+
+}
+
+func TestListen(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		dir     = t.TempDir()
+		file    = filepath.Join(dir, "bashrc")
+		stale   = filepath.Join(dir, "stale.sock")
+	)
+
+	// a mistyped socket path must not delete other files
+	require.NoError(os.WriteFile(file, []byte("export PATH"), 0o600))
+
+	_, err := Listen(file)
+	assert.EqualError(err, file+" exists and is not a socket")
+
+	buf, err := os.ReadFile(file)
+	require.NoError(err)
+	assert.Equal("export PATH", string(buf))
+
+	l, err := net.Listen("unix", stale)
+	require.NoError(err)
+
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = Listen(stale)
+	require.NoError(err)
+
+	defer l.Close()
+
+	_, err = Listen(stale)
+	assert.EqualError(err, "socket "+stale+" is in use by a running agent")
+
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath/internal/wire"
+)
+
+// Client talks to an agent and implements ykoath.Transport
+type Client struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+// Dial connects to the agent listening on a Unix socket
+func Dial(path string) (*Client, error) {
+
+	conn, err := net.Dial("unix", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn: conn,
+	}, nil
+
+}
+
+// Transmit sends an APDU to the agent and returns its response
+func (c *Client) Transmit(apdu []byte) ([]byte, error) {
+	return c.roundtrip(frameAPDU, apdu)
+}
+
+// AddPassword unlocks the key held by the agent, which keeps the derived
+// access key for its lifetime
+func (c *Client) AddPassword(password []byte) error {
+
+	_, err := c.roundtrip(frameAddKey, password)
+
+	return err
+
+}
+
+// Lock makes the agent forget its access key and close its session
+func (c *Client) Lock() error {
+
+	_, err := c.roundtrip(frameLock, nil)
+
+	return err
+
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// roundtrip sends a request frame and reads the response
+func (c *Client) roundtrip(kind byte, data []byte) ([]byte, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := wire.WriteFrame(c.conn, []byte{kind}, data); err != nil {
+		return nil, err
+	}
+
+	res, err := wire.ReadFrame(c.conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New(errEmptyFrame)
+	}
+
+	switch res[0] {
+	case frameResponse:
+		return res[1:], nil
+	case frameError:
+		return nil, fmt.Errorf(errAgent, res[1:])
+	default:
+		return nil, fmt.Errorf(errFrameType, res[0])
+	}
+
+}
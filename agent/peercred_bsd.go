@@ -0,0 +1,38 @@
+//go:build darwin || freebsd
+
+package agent
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerUID returns the user id of the process on the other end of a Unix
+// socket (LOCAL_PEERCRED)
+func peerUID(conn *net.UnixConn) (int, error) {
+
+	raw, err := conn.SyscallConn()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cred    *unix.Xucred
+		credErr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+
+	if credErr != nil {
+		return 0, credErr
+	}
+
+	return int(cred.Uid), nil
+
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerUID returns the user id of the process on the other end of a Unix
+// socket (SO_PEERCRED)
+func peerUID(conn *net.UnixConn) (int, error) {
+
+	raw, err := conn.SyscallConn()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+
+	if credErr != nil {
+		return 0, credErr
+	}
+
+	return int(cred.Uid), nil
+
+}
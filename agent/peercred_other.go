@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package agent
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// peerUID fails on platforms without peer credentials, refusing all
+// connections
+func peerUID(conn *net.UnixConn) (int, error) {
+	return 0, errors.New(errUnsupportedPeer)
+}
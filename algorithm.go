@@ -1,6 +1,12 @@
 package ykoath
 
-import "fmt"
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+)
 
 const (
 	// HmacSha1 describes a HMAC with SHA-1
@@ -31,3 +37,20 @@ func (a Algorithm) String() string {
 	}
 
 }
+
+// Hash returns the hash function of the algorithm (or nil for unknown
+// algorithms)
+func (a Algorithm) Hash() func() hash.Hash {
+
+	switch a {
+	case HmacSha1:
+		return sha1.New
+	case HmacSha256:
+		return sha256.New
+	case HmacSha512:
+		return sha512.New
+	default:
+		return nil
+	}
+
+}
@@ -0,0 +1,15 @@
+package ykoath
+
+// Authenticator is implemented by everything holding OATH credentials, such as
+// OATH sessions on a YubiKey and the software store of the soft package.
+// Applications using it can switch between hardware and software tokens by
+// configuration.
+type Authenticator interface {
+	Calculate(name string, touchRequiredCallback func(string) error) (string, error)
+	Close() error
+	Delete(name string) error
+	List() ([]*Name, error)
+	Put(name string, a Algorithm, t Type, digits uint8, key []byte, touch bool) error
+}
+
+var _ Authenticator = (*OATH)(nil)
@@ -3,48 +3,107 @@ package ykoath
 import (
 	"encoding/binary"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
 	errNoValuesFound = "no values found in response (% x)"
-	errUnknownName   = "no such name configued (%s)"
-	errMultipleMatches = "multiple matches found (%s)"
+	hotpAccount      = "hotp-account"
 	touchRequired    = "touch-required"
 )
 
+// cacheTTL bounds the age of the credentials cached from CALCULATE ALL, so
+// credentials added or changed by other applications are seen within one
+// default period
+const cacheTTL = defaultPeriod * time.Second
+
+// errCacheMiss indicates a name that cannot be resolved from the cache
+var errCacheMiss = errors.New("cache miss")
+
+var (
+	// ErrMultipleMatches indicates a query matching more than one credential
+	ErrMultipleMatches = errors.New("multiple matches found")
+
+	// ErrUnknownName indicates a query matching no credential
+	ErrUnknownName = errors.New("no such name configured")
+)
+
+// Code is a one-time password of a credential and the window it is valid in
+// (from inclusive, to exclusive). HOTP codes have no period and window.
+type Code struct {
+	Name      string
+	Period    int
+	Touch     bool
+	Type      Type
+	ValidFrom time.Time
+	ValidTo   time.Time
+	Value     string
+}
+
+// newCode returns a code without value, valid in the window around t
+func newCode(name string, t time.Time) *Code {
+
+	period, _ := splitPeriod(name)
+	from := t.Unix() / int64(period) * int64(period)
+
+	return &Code{
+		Name:      name,
+		Period:    period,
+		Type:      Totp,
+		ValidFrom: time.Unix(from, 0),
+		ValidTo:   time.Unix(from+int64(period), 0),
+	}
+
+}
+
+// newHOTPCode returns a HOTP code without value
+func newHOTPCode(name string) *Code {
+
+	return &Code{
+		Name: name,
+		Type: Hotp,
+	}
+
+}
+
 // Calculate is a high-level function that first identifies all TOTP credentials
 // that are configured and returns the matching one (if no touch is required) or
 // fires the callback and then fetches the name again while blocking during
-// the device awaiting touch
+// the device awaiting touch. Once the credentials are known, later calls only
+// calculate the matching credential. The known credentials are refreshed with
+// CALCULATE ALL once they are older than 30 seconds, so until then queries may
+// resolve against credentials that were since added, removed or changed by
+// other applications.
 func (o *OATH) Calculate(name string, touchRequiredCallback func(string) error) (string, error) {
 
-	res, err := o.calculateAll()
+	if o.cached() {
 
-	if err != nil {
-		return "", nil
-	}
-
-	// support matching by name without issuer in the same way that ykman does
-	// https://github.com/Yubico/yubikey-manager/blob/f493008d78a0ad09016f23dabd1cb658929d9c0e/ykman/cli/oath.py#L543
-	var key, code string
-	var matches []string
-	for k, c := range res {
-		if strings.Contains(strings.ToLower(k), strings.ToLower(name)) {
-			key = k
-			code = c
-			matches = append(matches, k)
+		code, err := o.calculateCached(name, touchRequiredCallback)
+
+		if err != errCacheMiss {
+			return code, err
 		}
+
 	}
-	if len(matches) > 1 {
-		return "", fmt.Errorf(errMultipleMatches, strings.Join(matches, ","))
+
+	res, err := o.calculateAll()
+
+	if err != nil {
+		return "", err
 	}
 
-	if key == "" {
-		return "", fmt.Errorf(errUnknownName, name)
+	key, err := o.matchOne(name, sortedKeys(res))
+
+	if err != nil {
+		return "", err
 	}
 
-	if code == touchRequired {
+	switch res[key] {
+	case touchRequired:
 
 		if err := touchRequiredCallback(name); err != nil {
 			return "", err
@@ -52,26 +111,197 @@ func (o *OATH) Calculate(name string, touchRequiredCallback func(string) error)
 
 		return o.calculate(key)
 
+	case hotpAccount:
+		return o.calculate(key)
+	}
+
+	// CALCULATE ALL only uses the default period
+	if period, _ := splitPeriod(key); period != defaultPeriod {
+		return o.calculate(key)
+	}
+
+	return res[key], nil
+
+}
+
+// CalculateAt is a high-level function like Calculate, returning the code of
+// the matching credential for an arbitrary point in time (using the period of
+// the credential) together with its validity window. For HOTP credentials t
+// is ignored, the code has no window and calculating it advances the counter
+// of the credential on the device.
+func (o *OATH) CalculateAt(name string, t time.Time, touchRequiredCallback func(string) error) (*Code, error) {
+
+	key, err := o.resolve(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if o.cache[key] == touchRequired {
+
+		if err := touchRequiredCallback(name); err != nil {
+			return nil, err
+		}
+
+	}
+
+	value, err := o.calculateAt(key, t)
+
+	if err != nil {
+
+		if isStatus(err, 0x69, 0x84) {
+			o.cache = nil
+		}
+
+		return nil, err
+
+	}
+
+	code := newCode(key, t)
+
+	if o.cache[key] == hotpAccount {
+		code = newHOTPCode(key)
 	}
 
+	code.Value = value
+
 	return code, nil
 
 }
 
+// CalculateAllAt returns the codes of all credentials for an arbitrary point
+// in time together with their validity windows, recalculating credentials
+// with a non-default period. Credentials requiring touch and HOTP credentials
+// (calculating advances their counter) have no value.
+func (o *OATH) CalculateAllAt(t time.Time) ([]*Code, error) {
+
+	res, err := o.calculateAllAt(t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []*Code
+
+	for _, name := range sortedKeys(res) {
+
+		code := newCode(name, t)
+
+		switch {
+		case res[name] == touchRequired:
+			code.Touch = true
+		case res[name] == hotpAccount:
+			code = newHOTPCode(name)
+		case code.Period != defaultPeriod:
+			if code.Value, err = o.calculateAt(name, t); err != nil {
+				return nil, err
+			}
+		default:
+			code.Value = res[name]
+		}
+
+		codes = append(codes, code)
+
+	}
+
+	return codes, nil
+
+}
+
+// resolve returns the single name matching a query, using the cached
+// credentials if possible
+func (o *OATH) resolve(name string) (string, error) {
+
+	if o.cached() {
+
+		if key, err := o.matchOne(name, sortedKeys(o.cache)); err == nil {
+			return key, nil
+		}
+
+	}
+
+	if _, err := o.calculateAll(); err != nil {
+		return "", err
+	}
+
+	return o.matchOne(name, sortedKeys(o.cache))
+
+}
+
+// calculateCached resolves a name against the credentials (and their touch
+// requirement) seen by the last CALCULATE ALL and calculates only the matching
+// credential. LIST is not used for the cache since it does not report touch
+// requirements. A stale cache results in errCacheMiss.
+func (o *OATH) calculateCached(name string, touchRequiredCallback func(string) error) (string, error) {
+
+	key, err := o.matchOne(name, sortedKeys(o.cache))
+
+	if err != nil {
+		return "", errCacheMiss
+	}
+
+	if o.cache[key] == touchRequired {
+
+		if err := touchRequiredCallback(name); err != nil {
+			return "", err
+		}
+
+	}
+
+	code, err := o.calculate(key)
+
+	if isStatus(err, 0x69, 0x84) {
+		o.cache = nil
+		return "", errCacheMiss
+	}
+
+	return code, err
+
+}
+
+// cached indicates credentials seen by a CALCULATE ALL less than cacheTTL
+// ago, as given by Clock
+func (o *OATH) cached() bool {
+	return o.cache != nil && o.Clock().Sub(o.cacheTime) < cacheTTL
+}
+
+// matchOne returns the single name matching a query, using the configured
+// matcher
+func (o *OATH) matchOne(query string, names []string) (string, error) {
+
+	matches, err := o.match(query, names)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w (%s)", ErrUnknownName, query)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w (%s)", ErrMultipleMatches, strings.Join(matches, ","))
+	}
+
+}
+
 // calculate implements the "CALCULATE" instruction to fetch a single
 // truncated TOTP response
 func (o *OATH) calculate(name string) (string, error) {
+	return o.calculateAt(name, o.Clock())
+}
 
-	var (
-		buf       = make([]byte, 8)
-		timestamp = o.Clock().Unix() / 30
-	)
+// calculateAt implements the "CALCULATE" instruction to fetch a single
+// truncated TOTP response for a point in time, using the period of the
+// credential
+func (o *OATH) calculateAt(name string, t time.Time) (string, error) {
 
-	binary.BigEndian.PutUint64(buf, uint64(timestamp))
+	period, _ := splitPeriod(name)
 
 	res, err := o.send(0x00, 0xa2, 0x00, 0x01,
 		write(0x71, []byte(name)),
-		write(0x74, buf),
+		write(0x74, challenge(t, period)),
 	)
 
 	if err != nil {
@@ -95,21 +325,24 @@ func (o *OATH) calculate(name string) (string, error) {
 
 }
 
-// calculateAll implements the "CALCULATE ALL" instruction to fetch all TOTP
-// tokens and their codes (or a constant indicating a touch requirement)
+// calculateAll implements the "CALCULATE ALL" instruction to fetch all
+// tokens and their codes (or constants indicating a touch requirement or a
+// HOTP credential)
 func (o *OATH) calculateAll() (map[string]string, error) {
+	return o.calculateAllAt(o.Clock())
+}
+
+// calculateAllAt implements the "CALCULATE ALL" instruction for a point in
+// time. All codes are calculated with the default period.
+func (o *OATH) calculateAllAt(t time.Time) (map[string]string, error) {
 
 	var (
-		buf       = make([]byte, 8)
-		codes     []string
-		names     []string
-		timestamp = o.Clock().Unix() / 30
+		codes []string
+		names []string
 	)
 
-	binary.BigEndian.PutUint64(buf, uint64(timestamp))
-
 	res, err := o.send(0x00, 0xa4, 0x00, 0x01,
-		write(0x74, buf),
+		write(0x74, challenge(t, defaultPeriod)),
 	)
 
 	if err != nil {
@@ -126,6 +359,9 @@ func (o *OATH) calculateAll() (map[string]string, error) {
 		case 0x7c:
 			codes = append(codes, touchRequired)
 
+		case 0x77:
+			codes = append(codes, hotpAccount)
+
 		case 0x76:
 			codes = append(codes, otp(tv.value))
 
@@ -135,16 +371,43 @@ func (o *OATH) calculateAll() (map[string]string, error) {
 
 	}
 
-	all := make(map[string]string, len(names))
+	var (
+		all   = make(map[string]string, len(names))
+		cache = make(map[string]string, len(names))
+	)
 
+	// the cache holds the names and the markers, not the codes
 	for idx, name := range names {
+
 		all[name] = codes[idx]
+
+		switch codes[idx] {
+		case touchRequired, hotpAccount:
+			cache[name] = codes[idx]
+		default:
+			cache[name] = ""
+		}
+
 	}
 
+	o.cache = cache
+	o.cacheTime = o.Clock()
+
 	return all, nil
 
 }
 
+// challenge returns the TOTP challenge (the number of periods since the
+// epoch) for a point in time
+func challenge(t time.Time, period int) []byte {
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.Unix()/int64(period)))
+
+	return buf
+
+}
+
 // otp converts a value into a (6 or 8 digits) one-time password
 func otp(value []byte) string {
 
@@ -153,3 +416,18 @@ func otp(value []byte) string {
 	return fmt.Sprintf(fmt.Sprintf("%%0%dd", digits), code)
 
 }
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys[V any](m map[string]V) []string {
+
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+
+}
@@ -0,0 +1,105 @@
+package ykoath
+
+import (
+	"github.com/pkg/errors"
+)
+
+const errFailedToRollBack = "failed to roll back"
+
+// CloneResult is the outcome of cloning a credential to one key out of a set
+// of keys. Written indicates that the key holds the credential, RolledBack
+// that it was deleted again after another key failed.
+type CloneResult struct {
+	Err        error
+	RolledBack bool
+	Serial     string
+	Written    bool
+}
+
+// CloneSet writes a credential to every key of a set (e.g. from NewSet), so
+// backup keys hold the same credentials. All keys are checked first: they
+// must be unlocked and must not hold a credential of the same name. If writing
+// to a key fails (e.g. with StatusNoSpace or because it was removed), the
+// credential is deleted again from the keys already written to. CloneSet
+// returns the results per key, in the order of the set, and the first error.
+func CloneSet(set []*OATH, c *CredentialData, touch bool) ([]*CloneResult, error) {
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		failure error
+		name    = c.Name()
+		results = make([]*CloneResult, len(set))
+	)
+
+	for idx, key := range set {
+
+		res := new(CloneResult)
+		res.Serial, res.Err = key.prepareClone(name)
+
+		if res.Err != nil && failure == nil {
+			failure = errors.Wrapf(res.Err, errFailedOnKey, res.Serial)
+		}
+
+		results[idx] = res
+
+	}
+
+	if failure != nil {
+		return results, failure
+	}
+
+	for idx, key := range set {
+
+		res := results[idx]
+
+		if res.Err = key.PutCredential(c, touch); res.Err != nil {
+			failure = errors.Wrapf(res.Err, errFailedOnKey, res.Serial)
+			break
+		}
+
+		res.Written = true
+
+	}
+
+	if failure == nil {
+		return results, nil
+	}
+
+	for idx, key := range set {
+
+		res := results[idx]
+
+		if !res.Written {
+			continue
+		}
+
+		if err := key.Delete(name); err != nil {
+			res.Err = errors.Wrapf(err, errFailedToRollBack)
+			continue
+		}
+
+		res.RolledBack = true
+		res.Written = false
+
+	}
+
+	return results, failure
+
+}
+
+// prepareClone reads the serial of a key, (re-)selects and unlocks the OATH
+// applet and makes sure the key does not hold a credential of the name yet
+func (o *OATH) prepareClone(name string) (string, error) {
+
+	serial, err := o.selectSet()
+
+	if err != nil {
+		return serial, err
+	}
+
+	return serial, o.ensureNew(name)
+
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yawn/ykoath"
+)
+
+const (
+	errUnknownAlgorithm = "unknown algorithm %q"
+	errUnknownType      = "unknown type %q"
+)
+
+// runAdd stores a credential from a raw secret or an otpauth URI
+func runAdd(c *cli, args []string) error {
+
+	credential, touch, err := c.parseAdd(args)
+
+	if err != nil {
+		return err
+	}
+
+	o, err := c.session()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	if err := o.PutCredential(credential, touch); err != nil {
+		return err
+	}
+
+	name := &ykoath.Name{
+		Algorithm: credential.Algorithm,
+		Name:      credential.Name(),
+		Type:      credential.Type,
+	}
+
+	return c.emit(&document{Credential: credentialOf(name)}, func(io.Writer) error {
+		_, err := fmt.Fprintf(c.stderr, "Added %s\n", name.Name)
+		return err
+	})
+
+}
+
+// parseAdd parses the arguments of the add command into a credential
+func (c *cli) parseAdd(args []string) (*ykoath.CredentialData, bool, error) {
+
+	var (
+		flags     = flag.NewFlagSet("add", flag.ContinueOnError)
+		algorithm = flags.String("algorithm", "SHA1", "algorithm (SHA1, SHA256 or SHA512)")
+		counter   = flags.Uint("counter", 0, "initial counter (HOTP)")
+		digits    = flags.Uint("digits", 6, "number of digits (6 to 8)")
+		hex       = flags.Bool("hex", false, "secret is hex instead of base32 encoded")
+		issuer    = flags.String("issuer", "", "issuer")
+		kind      = flags.String("type", "totp", "type (totp or hotp)")
+		period    = flags.Int("period", 30, "period in seconds (TOTP)")
+		touch     = flags.Bool("touch", false, "require touch")
+	)
+
+	flags.SetOutput(c.stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if flags.NArg() == 1 && strings.HasPrefix(flags.Arg(0), "otpauth://") {
+
+		credential, err := ykoath.ParseOTPAuthURI(flags.Arg(0))
+
+		return credential, *touch, err
+
+	}
+
+	if flags.NArg() != 2 {
+		return nil, false, usageError(usageAdd)
+	}
+
+	credential := &ykoath.CredentialData{
+		Account: flags.Arg(0),
+		Counter: uint32(*counter),
+		Digits:  uint8(*digits),
+		Issuer:  *issuer,
+		Period:  *period,
+	}
+
+	switch strings.ToUpper(*algorithm) {
+	case "SHA1":
+		credential.Algorithm = ykoath.HmacSha1
+	case "SHA256":
+		credential.Algorithm = ykoath.HmacSha256
+	case "SHA512":
+		credential.Algorithm = ykoath.HmacSha512
+	default:
+		return nil, false, fmt.Errorf(errUnknownAlgorithm, *algorithm)
+	}
+
+	switch strings.ToLower(*kind) {
+	case "totp":
+		credential.Type = ykoath.Totp
+	case "hotp":
+		credential.Type = ykoath.Hotp
+	default:
+		return nil, false, fmt.Errorf(errUnknownType, *kind)
+	}
+
+	var err error
+
+	if *hex {
+		credential.Secret, err = ykoath.DecodeHex(flags.Arg(1))
+	} else {
+		credential.Secret, err = ykoath.DecodeBase32(flags.Arg(1))
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return credential, *touch, credential.Validate()
+
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/yawn/ykoath"
+	"github.com/yawn/ykoath/agent"
+)
+
+// runAgent runs an agent in the foreground, printing the shell commands to
+// point clients at it
+func runAgent(c *cli, args []string) error {
+
+	var (
+		flags    = flag.NewFlagSet("agent", flag.ContinueOnError)
+		lifetime = flags.Duration("lifetime", 0, "forget the password after this duration (0 keeps it)")
+		socket   = flags.String("socket", "", "socket path (default: a new private directory)")
+	)
+
+	flags.SetOutput(c.stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return usageError(usageAgent)
+	}
+
+	if *socket == "" {
+
+		dir, err := os.MkdirTemp("", "ykoath-agent-")
+
+		if err != nil {
+			return err
+		}
+
+		defer os.RemoveAll(dir)
+
+		*socket = filepath.Join(dir, "agent.sock")
+
+	}
+
+	a := agent.New(func() (*ykoath.OATH, error) {
+		return c.open(c.serials)
+	})
+
+	a.Lifetime = *lifetime
+
+	if c.debug {
+		a.Debug = func(format string, args ...interface{}) {
+			fmt.Fprintf(c.stderr, format+"\n", args...)
+		}
+	}
+
+	// unlock right away if the password is at hand, otherwise clients add it
+	if c.password != "" {
+
+		if err := a.AddPassword([]byte(c.password)); err != nil {
+			return fmt.Errorf("%w: %v", errAuth, err)
+		}
+
+	}
+
+	l, err := agent.Listen(*socket)
+
+	if err != nil {
+		return err
+	}
+
+	defer l.Close()
+
+	fmt.Fprintf(c.stdout, "%s=%s; export %s;\n", agent.EnvSocket, *socket, agent.EnvSocket)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		l.Close()
+	}()
+
+	a.Serve(l)
+	a.Lock()
+
+	return nil
+
+}
+
+// readSession returns a session for reading credentials and codes, through
+// the agent at $YKOATH_AGENT_SOCK if one is running and no device was
+// selected with --serial
+func (c *cli) readSession() (*ykoath.OATH, error) {
+
+	path := os.Getenv(agent.EnvSocket)
+
+	if path == "" || len(c.serials) > 0 {
+		return c.session()
+	}
+
+	client, err := agent.Dial(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := ykoath.NewWithTransport(client)
+
+	s, err := o.Select()
+
+	if err != nil {
+		o.Close()
+		return nil, err
+	}
+
+	if !s.IsLocked() {
+		return o, nil
+	}
+
+	password, err := c.readPassword("Password: ", c.password)
+
+	if err == nil {
+		err = client.AddPassword([]byte(password))
+	}
+
+	if err != nil {
+		o.Close()
+		return nil, fmt.Errorf("%w: %v", errAuth, err)
+	}
+
+	return o, nil
+
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/yawn/ykoath"
+)
+
+// runCode calculates the code of the credential matching a query or the codes
+// of all credentials
+func runCode(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("code", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	single := flags.Bool("s", false, "print the code only (requires a query)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 1 || (*single && flags.NArg() == 0) {
+		return usageError(usageCode)
+	}
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	if query := flags.Arg(0); query != "" {
+
+		code, err := o.CalculateAt(query, o.Clock(), c.touch)
+
+		if err != nil {
+			return err
+		}
+
+		return c.emit(&document{Code: code}, func(w io.Writer) error {
+
+			if *single {
+				_, err := fmt.Fprintln(w, code.Value)
+				return err
+			}
+
+			_, err := fmt.Fprintf(w, "%s  %s\n", code.Name, code.Value)
+			return err
+
+		})
+
+	}
+
+	codes, err := o.CalculateAllAt(o.Clock())
+
+	if err != nil {
+		return err
+	}
+
+	if codes == nil {
+		codes = []*ykoath.Code{}
+	}
+
+	return c.emit(&document{Codes: &codes}, func(w io.Writer) error {
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		for _, code := range codes {
+
+			switch {
+			case code.Touch:
+				fmt.Fprintf(tw, "%s\t%s\n", code.Name, ykmanTouch)
+			case code.Type == ykoath.Hotp:
+				fmt.Fprintf(tw, "%s\t%s\n", code.Name, ykmanHOTP)
+			default:
+				fmt.Fprintf(tw, "%s\t%s\n", code.Name, code.Value)
+			}
+
+		}
+
+		return tw.Flush()
+
+	})
+
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yawn/ykoath"
+)
+
+// runDelete deletes the credential matching a query
+func runDelete(c *cli, args []string) error {
+
+	if len(args) != 1 {
+		return usageError(usageDelete)
+	}
+
+	o, err := c.session()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	credential, err := findOne(o, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	if err := o.Delete(credential.Name); err != nil {
+		return err
+	}
+
+	return c.emit(&document{Credential: credential}, func(io.Writer) error {
+		_, err := fmt.Fprintf(c.stderr, "Deleted %s\n", credential.Name)
+		return err
+	})
+
+}
+
+// runRename renames the credential matching a query
+func runRename(c *cli, args []string) error {
+
+	if len(args) != 2 {
+		return usageError(usageRename)
+	}
+
+	o, err := c.session()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	credential, err := findOne(o, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	if err := o.Rename(credential.Name, args[1]); err != nil {
+		return err
+	}
+
+	renamed := credentialOf(&ykoath.Name{
+		Algorithm: credential.Algorithm,
+		Name:      args[1],
+		Type:      credential.Type,
+	})
+
+	return c.emit(&document{Credential: renamed}, func(io.Writer) error {
+		_, err := fmt.Fprintf(c.stderr, "Renamed %s to %s\n", credential.Name, renamed.Name)
+		return err
+	})
+
+}
+
+// findOne returns the single credential matching a query
+func findOne(o *ykoath.OATH, query string) (*ykoath.Credential, error) {
+
+	credentials, err := o.Find(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(credentials) {
+	case 0:
+		return nil, fmt.Errorf("%w (%s)", ykoath.ErrUnknownName, query)
+	case 1:
+		return &credentials[0], nil
+	}
+
+	names := make([]string, len(credentials))
+
+	for idx, credential := range credentials {
+		names[idx] = credential.Name
+	}
+
+	return nil, fmt.Errorf("%w (%s)", ykoath.ErrMultipleMatches, strings.Join(names, ","))
+
+}
+
+// credentialOf returns the credential described by a name
+func credentialOf(name *ykoath.Name) *ykoath.Credential {
+
+	credential := name.Credential()
+
+	return &credential
+
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yawn/ykoath"
+)
+
+// placeholder is replaced with the code in arguments and environment
+// variable templates of exec
+const placeholder = "{code}"
+
+// runExec calculates a code and executes a command with the code substituted
+// into environment variables and arguments
+func runExec(c *cli, args []string) error {
+
+	var envs []string
+
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	query := flags.String("credential", "", "query of the credential")
+	validity := flags.Duration("min-validity", 5*time.Second, "minimum validity of the code, waiting for the next window otherwise")
+	flags.Func("env", "environment variable set to the code or to a template like NAME="+placeholder+" (may be repeated)", func(v string) error {
+		envs = append(envs, v)
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *query == "" || flags.NArg() == 0 {
+		return usageError(usageExec)
+	}
+
+	code, err := c.freshCode(*query, *validity)
+
+	if err != nil {
+		return err
+	}
+
+	argv := make([]string, flags.NArg())
+
+	for idx, arg := range flags.Args() {
+		argv[idx] = strings.ReplaceAll(arg, placeholder, code.Value)
+	}
+
+	env := os.Environ()
+
+	for _, v := range envs {
+
+		name, template, ok := strings.Cut(v, "=")
+
+		if !ok {
+			template = placeholder
+		}
+
+		env = setenv(env, name, strings.ReplaceAll(template, placeholder, code.Value))
+
+	}
+
+	return c.exec(argv, env)
+
+}
+
+// freshCode calculates the code of the credential matching a query, waiting
+// for the next window if the current one ends within validity
+func (c *cli) freshCode(query string, validity time.Duration) (*ykoath.Code, error) {
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer o.Close()
+
+	credential, err := findOne(o, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if credential.Type == ykoath.Totp {
+
+		period := time.Duration(credential.Period) * time.Second
+		left := period - time.Duration(o.Clock().UnixNano()%int64(period))
+
+		if left < validity {
+			fmt.Fprintf(c.stderr, "Waiting %s for a fresh code...\n", left.Round(time.Second))
+			c.sleep(left)
+		}
+
+	}
+
+	return o.CalculateAt(credential.Name, o.Clock(), c.touch)
+
+}
+
+// setenv sets a variable in an environment, replacing previous values
+func setenv(env []string, name, value string) []string {
+
+	result := make([]string, 0, len(env)+1)
+
+	for _, v := range env {
+
+		if !strings.HasPrefix(v, name+"=") {
+			result = append(result, v)
+		}
+
+	}
+
+	return append(result, name+"="+value)
+
+}
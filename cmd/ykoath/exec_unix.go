@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// execve replaces the process with a command
+func execve(argv, env []string) error {
+
+	path, err := exec.LookPath(argv[0])
+
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, argv, env)
+
+}
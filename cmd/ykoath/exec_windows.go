@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// execve runs a command and exits with its exit code, since Windows cannot
+// replace a process
+func execve(argv, env []string) error {
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	var exit *exec.ExitError
+
+	if err := cmd.Run(); errors.As(err, &exit) {
+		os.Exit(exit.ExitCode())
+	} else if err != nil {
+		return err
+	}
+
+	os.Exit(exitOK)
+
+	return nil
+
+}
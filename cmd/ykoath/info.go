@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// runInfo shows the serial, firmware version and password status of the
+// device
+func runInfo(c *cli, args []string) error {
+
+	if len(args) != 0 {
+		return usageError(usageInfo)
+	}
+
+	// info does not require the device to be unlocked
+	o, err := c.open(c.serials)
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	s, err := o.Select()
+
+	if err != nil {
+		return err
+	}
+
+	serial, _ := o.Serial()
+
+	return c.emit(&document{Device: s, Serial: serial}, func(w io.Writer) error {
+
+		var (
+			password = "disabled"
+			known    = serial
+		)
+
+		if s.IsLocked() {
+			password = "enabled"
+		}
+
+		if known == "" {
+			known = "unknown"
+		}
+
+		fmt.Fprintf(w, "Serial: %s\n", known)
+		fmt.Fprintf(w, "OATH version: %s\n", s.VersionString())
+		fmt.Fprintf(w, "Password protection: %s\n", password)
+
+		return nil
+
+	})
+
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/yawn/ykoath"
+)
+
+// runList lists all credentials
+func runList(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	verbose := flags.Bool("v", false, "show algorithm and type")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return usageError(usageList)
+	}
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	names, err := o.List()
+
+	if err != nil {
+		return err
+	}
+
+	credentials := make([]ykoath.Credential, len(names))
+
+	for idx, name := range names {
+		credentials[idx] = name.Credential()
+	}
+
+	return c.emit(&document{Credentials: &credentials}, func(w io.Writer) error {
+
+		for _, name := range names {
+
+			if *verbose {
+				fmt.Fprintln(w, name.String())
+			} else {
+				fmt.Fprintln(w, name.Name)
+			}
+
+		}
+
+		return nil
+
+	})
+
+}
@@ -0,0 +1,343 @@
+// Command ykoath manages and calculates the OATH credentials of YubiKeys.
+//
+// Exit codes are stable and can be relied on by scripts: 0 (success), 1 (any
+// other error), 2 (usage), 3 (no credential matches the query), 4 (multiple
+// credentials match the query), 5 (credential was not touched in time) and 6
+// (device is password protected and has not been unlocked).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yawn/ykoath"
+	"golang.org/x/term"
+)
+
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	exitNoMatch
+	exitMultipleMatches
+	exitTouchTimeout
+	exitAuthRequired
+)
+
+const (
+	envPassword = "YKOATH_PASSWORD"
+
+	errAuthRequired = "device is password protected (use $%s or a terminal)"
+	errWrongUsage   = "usage: %s"
+)
+
+var errAuth = errors.New("authentication required")
+
+// command is a subcommand of the CLI
+type command struct {
+	run   func(c *cli, args []string) error
+	usage string
+}
+
+// usages of the commands
+const (
+	usageAdd        = "add [flags] name secret | add [flags] otpauth://..."
+	usageAgent      = "agent [-socket path] [-lifetime duration]"
+	usageApply      = "apply [-f] manifest"
+	usageApplyStdin = "apply -f - (reading the manifest from stdin requires -f)"
+	usageCode       = "code [-s] [query]"
+	usageDelete     = "delete query"
+	usageExec       = "exec -credential query [-env NAME[=template]] [-min-validity duration] -- command [args]"
+	usageInfo       = "info"
+	usageList       = "list [-v]"
+	usageNative     = "native-host [-config path]"
+	usageOath       = "oath accounts code [-s] [-H] [query] | oath accounts list [-H] [-o] [-P]"
+	usagePassword   = "password set|clear|unlock"
+	usagePlan       = "plan manifest"
+	usageRename     = "rename query name"
+	usageReset      = "reset [-f]"
+	usageTUI        = "tui"
+)
+
+var commands = map[string]command{
+	"add":         {runAdd, usageAdd},
+	"agent":       {runAgent, usageAgent},
+	"apply":       {runApply, usageApply},
+	"code":        {runCode, usageCode},
+	"delete":      {runDelete, usageDelete},
+	"exec":        {runExec, usageExec},
+	"info":        {runInfo, usageInfo},
+	"list":        {runList, usageList},
+	"native-host": {runNativeHost, usageNative},
+	"oath":        {runOath, usageOath},
+	"password":    {runPassword, usagePassword},
+	"plan":        {runPlan, usagePlan},
+	"rename":      {runRename, usageRename},
+	"reset":       {runReset, usageReset},
+	"tui":         {runTUI, usageTUI},
+}
+
+// cli holds the global flags and the environment of the CLI
+type cli struct {
+	compat   bool
+	debug    bool
+	exec     func(argv, env []string) error
+	open     func(serials []string) (*ykoath.OATH, error)
+	output   string
+	password string
+	serials  []string
+	sleep    func(time.Duration)
+	stderr   io.Writer
+	stdin    io.Reader
+	stdout   io.Writer
+}
+
+// usageError indicates a wrong invocation
+type usageError string
+
+func (u usageError) Error() string {
+	return fmt.Sprintf(errWrongUsage, string(u))
+}
+
+func main() {
+
+	c := &cli{
+		exec:     execve,
+		open:     ykoath.NewFromSerialList,
+		password: os.Getenv(envPassword),
+		sleep:    time.Sleep,
+		stderr:   os.Stderr,
+		stdin:    os.Stdin,
+		stdout:   os.Stdout,
+	}
+
+	switch command := filepath.Base(os.Args[0]); {
+	case isYkman(command):
+		os.Exit(c.runYkman(os.Args[1:]))
+	case isNativeHost(command):
+		os.Exit(exitCode(runNativeHost(c, nil)))
+	}
+
+	os.Exit(c.run(os.Args[1:]))
+
+}
+
+// run parses the global flags, runs a subcommand and returns the exit code
+func (c *cli) run(args []string) int {
+
+	flags := flag.NewFlagSet("ykoath", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: ykoath [--serial serial[,serial]] [--output text|json|yaml] [--debug] command\n\ncommands:\n")
+		for _, name := range sortedCommands() {
+			fmt.Fprintf(c.stderr, "  %s\n", commands[name].usage)
+		}
+	}
+
+	flags.BoolVar(&c.debug, "debug", false, "print APDUs")
+	flags.Func("output", "output format (text, json or yaml)", func(v string) (err error) {
+		c.output, err = parseOutput(v)
+		return err
+	})
+	flags.Func("serial", "serial of the device to use (may be repeated or comma separated)", func(v string) error {
+		c.serials = append(c.serials, strings.Split(v, ",")...)
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+
+	if !ok {
+		flags.Usage()
+		return exitUsage
+	}
+
+	err := cmd.run(c, flags.Args()[1:])
+
+	if err != nil {
+		c.fail(err)
+	}
+
+	return exitCode(err)
+
+}
+
+// fail reports an error on stderr or, with structured output, as document on
+// stdout
+func (c *cli) fail(err error) {
+
+	var usage usageError
+
+	if c.compat {
+		fmt.Fprintf(c.stderr, "Error: %v\n", err)
+		return
+	}
+
+	if !c.structured() || errors.As(err, &usage) || errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(c.stderr, "ykoath: %v\n", err)
+		return
+	}
+
+	encode(c.stdout, c.output, &document{
+		Schema: ykoath.SchemaVersion,
+		Error:  ykoath.NewErrorInfo(err),
+	})
+
+}
+
+// exitCode maps an error to a stable exit code
+func exitCode(err error) int {
+
+	if err == nil {
+		return exitOK
+	}
+
+	var usage usageError
+
+	if errors.As(err, &usage) || errors.Is(err, flag.ErrHelp) {
+		return exitUsage
+	}
+
+	if errors.Is(err, ykoath.ErrUnknownName) {
+		return exitNoMatch
+	}
+
+	if errors.Is(err, ykoath.ErrMultipleMatches) {
+		return exitMultipleMatches
+	}
+
+	if errors.Is(err, errAuth) {
+		return exitAuthRequired
+	}
+
+	switch sw, _ := ykoath.StatusWord(err); sw {
+	case ykoath.StatusTouchTimeout:
+		return exitTouchTimeout
+	case ykoath.StatusAuthRequired:
+		return exitAuthRequired
+	}
+
+	return exitError
+
+}
+
+// session opens the device selected by --serial, unlocking it if it is
+// password protected
+func (c *cli) session() (*ykoath.OATH, error) {
+
+	o, _, err := c.unlockedSession()
+
+	return o, err
+
+}
+
+// unlockedSession is session, also reporting if the device is password
+// protected
+func (c *cli) unlockedSession() (*ykoath.OATH, bool, error) {
+
+	o, err := c.open(c.serials)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.debug {
+		o.Debug = func(format string, args ...interface{}) {
+			fmt.Fprintf(c.stderr, format+"\n", args...)
+		}
+	}
+
+	s, err := o.Select()
+
+	if err != nil {
+		o.Close()
+		return nil, false, err
+	}
+
+	if !s.IsLocked() {
+		return o, false, nil
+	}
+
+	password, err := c.readPassword("Password: ", c.password)
+
+	if err != nil {
+		o.Close()
+		return nil, false, err
+	}
+
+	if err := o.Unlock([]byte(password)); err != nil {
+		o.Close()
+		return nil, false, fmt.Errorf("%w: %v", errAuth, err)
+	}
+
+	return o, true, nil
+
+}
+
+// readPassword returns a given password or prompts for it on the terminal (the
+// console on Windows)
+func (c *cli) readPassword(prompt, given string) (string, error) {
+
+	if given != "" {
+		return given, nil
+	}
+
+	in, out, err := openTerminal()
+
+	if err != nil {
+		return "", fmt.Errorf("%w: "+errAuthRequired, errAuth, envPassword)
+	}
+
+	defer in.Close()
+
+	if out != in {
+		defer out.Close()
+	}
+
+	if !term.IsTerminal(int(in.Fd())) {
+		return "", fmt.Errorf("%w: "+errAuthRequired, errAuth, envPassword)
+	}
+
+	fmt.Fprint(out, prompt)
+	password, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(out)
+
+	return string(password), err
+
+}
+
+// touch prompts for touching the device on stderr
+func (c *cli) touch(name string) error {
+	fmt.Fprintf(c.stderr, "Touch your YubiKey to calculate %s...\n", name)
+	return nil
+}
+
+// sortedCommands returns the sorted names of all commands
+func sortedCommands() []string {
+
+	names := make([]string, 0, len(commands))
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+
+}
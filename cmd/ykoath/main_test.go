@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yawn/ykoath"
+)
+
+// testTransport answers APDUs from a fixed transcript
+type testTransport struct {
+	responses map[string][]byte
+}
+
+func (t *testTransport) Transmit(apdu []byte) ([]byte, error) {
+
+	key := fmt.Sprintf("% x", apdu)
+
+	if res, ok := t.responses[key]; ok {
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("unexpected APDU %s", key)
+
+}
+
+func (t *testTransport) Close() error {
+	return nil
+}
+
+// testCLI returns a CLI talking to a device holding two credentials
+func testCLI() (*cli, *bytes.Buffer, *bytes.Buffer) {
+
+	var (
+		list      []byte
+		stderr    = new(bytes.Buffer)
+		stdout    = new(bytes.Buffer)
+		transport = &testTransport{
+			responses: map[string][]byte{
+				"00 a4 04 00 07 a0 00 00 05 27 21 01": {0x79, 0x03, 0x05, 0x04, 0x03, 0x90, 0x00},
+			},
+		}
+	)
+
+	for _, name := range []string{"GitHub:me", "GitHub:you"} {
+		list = append(list, 0x72, byte(len(name)+1), 0x21)
+		list = append(list, name...)
+	}
+
+	transport.responses["00 a1 00 00"] = append(list, 0x90, 0x00)
+
+	return &cli{
+		open: func(serials []string) (*ykoath.OATH, error) {
+			return ykoath.NewWithTransport(transport), nil
+		},
+		stderr: stderr,
+		stdin:  strings.NewReader(""),
+		stdout: stdout,
+	}, stdout, stderr
+
+}
+
+// tlv encodes a tag, length and value
+func tlv(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value))}, value...)
+}
+
+// apdu returns the transcript key of an APDU
+func apdu(ins, p1, p2 byte, tlvs ...[]byte) string {
+
+	var data []byte
+
+	for _, tlv := range tlvs {
+		data = append(data, tlv...)
+	}
+
+	return fmt.Sprintf("% x", append([]byte{0x00, ins, p1, p2, byte(len(data))}, data...))
+
+}
+
+// testYkmanCLI returns a CLI talking to a device with TOTP, HOTP, touch and
+// hidden credentials at a fixed point in time
+func testYkmanCLI() (*cli, *bytes.Buffer, *bytes.Buffer) {
+
+	var (
+		all       []byte
+		list      []byte
+		stderr    = new(bytes.Buffer)
+		stdout    = new(bytes.Buffer)
+		challenge = func(v byte) []byte { return tlv(0x74, []byte{0, 0, 0, 0, 0, 0, 0, v}) }
+		transport = &testTransport{
+			responses: map[string][]byte{
+				"00 a4 04 00 07 a0 00 00 05 27 21 01":                                {0x79, 0x03, 0x05, 0x04, 0x03, 0x90, 0x00},
+				apdu(0xa2, 0x00, 0x01, tlv(0x71, []byte("60/VPN:me")), challenge(0)): {0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x02, 0x90, 0x00},
+				apdu(0xa2, 0x00, 0x01, tlv(0x71, []byte("counter")), challenge(1)):   {0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x03, 0x90, 0x00},
+				apdu(0xa2, 0x00, 0x01, tlv(0x71, []byte("touchy")), challenge(1)):    {0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x04, 0x90, 0x00},
+			},
+		}
+	)
+
+	for _, credential := range []struct {
+		Name     string
+		Kind     byte
+		Response []byte
+	}{
+		{"GitHub:me", 0x21, []byte{0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x01}},
+		{"60/VPN:me", 0x21, []byte{0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x09}},
+		{"counter", 0x11, []byte{0x77, 0x01, 0x06}},
+		{"touchy", 0x21, []byte{0x7c, 0x01, 0x06}},
+		{"_hidden:secret", 0x21, []byte{0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x05}},
+		{"apple", 0x22, []byte{0x76, 0x05, 0x08, 0x00, 0x00, 0x00, 0x06}},
+	} {
+		list = append(list, tlv(0x72, append([]byte{credential.Kind}, credential.Name...))...)
+		all = append(all, tlv(0x71, []byte(credential.Name))...)
+		all = append(all, credential.Response...)
+	}
+
+	transport.responses["00 a1 00 00"] = append(list, 0x90, 0x00)
+	transport.responses[apdu(0xa4, 0x00, 0x01, challenge(1))] = append(all, 0x90, 0x00)
+
+	return &cli{
+		open: func(serials []string) (*ykoath.OATH, error) {
+
+			o := ykoath.NewWithTransport(transport)
+			o.Clock = func() time.Time {
+				return time.Unix(59, 0)
+			}
+
+			return o, nil
+
+		},
+		stderr: stderr,
+		stdin:  strings.NewReader(""),
+		stdout: stdout,
+	}, stdout, stderr
+
+}
+
+func TestExec(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		challenge = tlv(0x74, []byte{0, 0, 0, 0, 0, 0, 0, 2})
+		response  = []byte{0x76, 0x05, 0x06, 0x00, 0x00, 0x00, 0x07}
+		transport = &testTransport{
+			responses: map[string][]byte{
+				"00 a4 04 00 07 a0 00 00 05 27 21 01": {0x79, 0x03, 0x05, 0x04, 0x03, 0x90, 0x00},
+				"00 a1 00 00":                         append(tlv(0x72, append([]byte{0x21}, "GitHub:me"...)), 0x90, 0x00),
+				apdu(0xa4, 0x00, 0x01, challenge):     append(append(tlv(0x71, []byte("GitHub:me")), response...), 0x90, 0x00),
+				apdu(0xa2, 0x00, 0x01, tlv(0x71, []byte("GitHub:me")), challenge): append(response, 0x90, 0x00),
+			},
+		}
+	)
+
+	for _, test := range []struct {
+		Args []string
+		Code int
+		Argv []string
+		Env  string
+		Wait time.Duration
+	}{
+		{[]string{"exec", "--credential", "me", "--env", "MFA_CODE", "--", "aws", "--token-code", "{code}"}, exitOK, []string{"aws", "--token-code", "000007"}, "MFA_CODE=000007", time.Second},
+		{[]string{"exec", "--credential", "me", "--env", "TOKEN=mfa-{code}", "--min-validity", "0", "--", "vault"}, exitOK, []string{"vault"}, "TOKEN=mfa-000007", 0},
+		{[]string{"exec", "--credential", "GitLab", "--", "vault"}, exitNoMatch, nil, "", 0},
+		{[]string{"exec", "--", "vault"}, exitUsage, nil, "", 0},
+		{[]string{"exec", "--credential", "me"}, exitUsage, nil, "", 0},
+	} {
+
+		var (
+			argv  []string
+			env   []string
+			now   = time.Unix(59, 0)
+			start = now
+		)
+
+		if test.Wait == 0 {
+			now = time.Unix(60, 0)
+			start = now
+		}
+
+		c, _, _ := testCLI()
+
+		c.exec = func(a, e []string) error {
+			argv, env = a, e
+			return nil
+		}
+
+		c.open = func(serials []string) (*ykoath.OATH, error) {
+
+			o := ykoath.NewWithTransport(transport)
+			o.Clock = func() time.Time {
+				return now
+			}
+
+			return o, nil
+
+		}
+
+		c.sleep = func(d time.Duration) {
+			now = now.Add(d)
+		}
+
+		assert.Equal(test.Code, c.run(test.Args), fmt.Sprint(test.Args))
+		assert.Equal(test.Argv, argv, fmt.Sprint(test.Args))
+		assert.Equal(test.Wait, now.Sub(start), fmt.Sprint(test.Args))
+
+		if test.Env != "" {
+			assert.Contains(env, test.Env)
+		}
+
+	}
+
+}
+
+func TestExitCode(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		Err  error
+		Code int
+	}{
+		{nil, exitOK},
+		{errors.New("failure"), exitError},
+		{usageError(usageList), exitUsage},
+		{fmt.Errorf("%w (x)", ykoath.ErrUnknownName), exitNoMatch},
+		{fmt.Errorf("%w (x)", ykoath.ErrMultipleMatches), exitMultipleMatches},
+		{fmt.Errorf("%w: wrong password", errAuth), exitAuthRequired},
+	} {
+		assert.Equal(test.Code, exitCode(test.Err), fmt.Sprint(test.Err))
+	}
+
+}
+
+func TestParseAdd(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		c, _, _ = testCLI()
+	)
+
+	credential, touch, err := c.parseAdd([]string{"--touch", "--issuer", "GitHub", "--digits", "8", "me", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"})
+	assert.NoError(err)
+	assert.True(touch)
+	assert.Equal("GitHub:me", credential.Name())
+	assert.EqualValues(8, credential.Digits)
+	assert.Equal(ykoath.HmacSha1, credential.Algorithm)
+
+	credential, _, err = c.parseAdd([]string{"otpauth://hotp/me?secret=GEZDGNBVGY3TQOJQ&counter=3"})
+	assert.NoError(err)
+	assert.Equal(ykoath.Hotp, credential.Type)
+	assert.EqualValues(3, credential.Counter)
+
+	_, _, err = c.parseAdd([]string{"--algorithm", "MD5", "me", "GEZDGNBVGY3TQOJQ"})
+	assert.Error(err)
+
+	_, _, err = c.parseAdd([]string{"me"})
+	assert.Equal(exitUsage, exitCode(err))
+
+}
+
+func TestRun(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		Args   []string
+		Code   int
+		Stdout string
+	}{
+		{nil, exitUsage, ""},
+		{[]string{"unknown"}, exitUsage, ""},
+		{[]string{"list"}, exitOK, "GitHub:me\nGitHub:you\n"},
+		{[]string{"list", "-v"}, exitOK, "GitHub:me (HMAC-SHA1 TOTP)\nGitHub:you (HMAC-SHA1 TOTP)\n"},
+		{[]string{"list", "extra"}, exitUsage, ""},
+		{[]string{"delete", "GitHub"}, exitMultipleMatches, ""},
+		{[]string{"delete", "GitLab"}, exitNoMatch, ""},
+		{[]string{"rename", "GitLab", "other"}, exitNoMatch, ""},
+		{[]string{"reset"}, exitError, ""},
+		{[]string{"plan"}, exitUsage, ""},
+		{[]string{"apply", "missing.yaml"}, exitError, ""},
+		{[]string{"apply", "-"}, exitUsage, ""},
+		{[]string{"info"}, exitOK, "Serial: unknown\nOATH version: 5.4.3\nPassword protection: disabled\n"},
+		{[]string{"--output", "xml", "list"}, exitUsage, ""},
+		{[]string{"--output", "json", "list"}, exitOK, `{"schema":1,"credentials":[` +
+			`{"account":"me","algorithm":"HMAC-SHA1","issuer":"GitHub","name":"GitHub:me","period":30,"type":"TOTP"},` +
+			`{"account":"you","algorithm":"HMAC-SHA1","issuer":"GitHub","name":"GitHub:you","period":30,"type":"TOTP"}]}` + "\n"},
+		{[]string{"--output", "json", "delete", "GitHub"}, exitMultipleMatches, `{"schema":1,"error":{"message":"multiple matches found (GitHub:me,GitHub:you)"}}` + "\n"},
+		{[]string{"--output", "yaml", "info"}, exitOK, "schema: 1\ndevice:\n  locked: false\n  version: 5.4.3\n"},
+	} {
+
+		c, stdout, _ := testCLI()
+
+		assert.Equal(test.Code, c.run(test.Args), fmt.Sprint(test.Args))
+		assert.Equal(test.Stdout, stdout.String(), fmt.Sprint(test.Args))
+
+	}
+
+	// collections are emitted on keys without credentials
+	for _, test := range []struct {
+		Args   []string
+		Stdout string
+	}{
+		{[]string{"--output", "json", "list"}, `{"schema":1,"credentials":[]}` + "\n"},
+		{[]string{"--output", "json", "code"}, `{"schema":1,"codes":[]}` + "\n"},
+	} {
+
+		c, stdout, _ := testCLI()
+
+		c.open = func([]string) (*ykoath.OATH, error) {
+
+			o := ykoath.NewWithTransport(&testTransport{
+				responses: map[string][]byte{
+					"00 a4 04 00 07 a0 00 00 05 27 21 01":          {0x79, 0x03, 0x05, 0x04, 0x03, 0x90, 0x00},
+					"00 a1 00 00":                                  {0x90, 0x00},
+					"00 a4 00 01 0a 74 08 00 00 00 00 00 00 00 01": {0x90, 0x00},
+				},
+			})
+
+			o.Clock = func() time.Time {
+				return time.Unix(59, 0)
+			}
+
+			return o, nil
+
+		}
+
+		assert.Equal(exitOK, c.run(test.Args), fmt.Sprint(test.Args))
+		assert.Equal(test.Stdout, stdout.String(), fmt.Sprint(test.Args))
+
+	}
+
+	c, _, stderr := testCLI()
+
+	assert.Equal(exitOK, c.run([]string{"password", "unlock"}))
+	assert.Equal("Key is not password protected\n", stderr.String())
+
+}
+
+func TestTUI(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		out       = new(bytes.Buffer)
+		requested []string
+		window    = func(name, value string, pending bool, kind ykoath.Type) ykoath.CodeUpdate {
+
+			code := &ykoath.Code{Name: name, Type: kind, Value: value}
+
+			if kind == ykoath.Totp {
+				code.Period = 30
+				code.ValidFrom = time.Unix(30, 0)
+				code.ValidTo = time.Unix(60, 0)
+				code.Touch = pending
+			}
+
+			return ykoath.CodeUpdate{Code: code, Pending: pending}
+
+		}
+		model = &tuiModel{
+			entries: make(map[string]*tuiEntry),
+			now: func() time.Time {
+				return time.Unix(50, 0)
+			},
+			out: out,
+			request: func(e *tuiEntry) {
+				requested = append(requested, e.update.Code.Name)
+			},
+		}
+		screen = func() string {
+
+			var buf bytes.Buffer
+
+			model.render(&buf, 80, 6)
+
+			return buf.String()
+
+		}
+	)
+
+	model.update("123", window("GitHub:me", "123456", false, ykoath.Totp))
+	model.update("123", window("touchy", "", true, ykoath.Totp))
+	model.update("123", window("counter", "", true, ykoath.Hotp))
+	model.update("456", window("GitHub:me", "654321", false, ykoath.Totp))
+
+	assert.Equal("\x1b[H"+
+		"Search (exact then substring): \x1b[K\r\n"+
+		"> GitHub:me  123456    [####------] 10s  123\x1b[K\r\n"+
+		"  GitHub:me  654321    [####------] 10s  456\x1b[K\r\n"+
+		"  counter    [HOTP]                      123\x1b[K\r\n"+
+		"  touchy     [Touch]   [####------] 10s  123\x1b[K\r\n"+
+		"up/down select  enter copy (touch)  tab matcher  ctrl-u clear  ctrl-c quit\x1b[K\x1b[J", screen())
+
+	assert.False(model.key([]byte("git\x1b[B\r")))
+	assert.Equal("git", model.query)
+	assert.Equal("\x1b]52;c;NjU0MzIx\a", out.String())
+	assert.Equal("Copied GitHub:me", model.status)
+
+	out.Reset()
+
+	assert.False(model.key([]byte("\x15tou\x1b[A\r")))
+	assert.Equal([]string{"touchy"}, requested)
+	assert.Empty(out.String())
+
+	model.update("123", ykoath.CodeUpdate{Code: &ykoath.Code{Name: "touchy", Touch: true, Type: ykoath.Totp, Value: "000042"}})
+	assert.Equal("\x1b]52;c;MDAwMDQy\a", out.String())
+
+	assert.False(model.key([]byte("\x7f\x7f\x7f(\t\t\t\t\t")))
+	assert.Equal("regexp", tuiMatchers[model.matcher].name)
+	assert.Contains(screen(), "(invalid query)")
+
+	model.remove("123")
+
+	assert.False(model.key([]byte("\x1b")))
+	assert.Len(model.entries, 1)
+	assert.Contains(screen(), "GitHub:me  654321")
+	assert.True(model.key([]byte{0x03}))
+
+}
+
+func TestYkman(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		Args   []string
+		Code   int
+		Stdout string
+		Stderr string
+	}{
+		{[]string{"oath", "accounts", "list"}, exitOK, "apple\ncounter\nGitHub:me\ntouchy\n60/VPN:me\n", ""},
+		{[]string{"oath", "accounts", "list", "-H", "-o", "--period"}, exitOK, "_hidden:secret, TOTP, 30\napple, TOTP, 30\ncounter, HOTP, 30\nGitHub:me, TOTP, 30\ntouchy, TOTP, 30\n60/VPN:me, TOTP, 60\n", ""},
+		{[]string{"oath", "accounts", "code"}, exitOK, "" +
+			"apple              00000006\n" +
+			"counter      [HOTP Account]\n" +
+			"GitHub:me            000001\n" +
+			"touchy     [Requires Touch]\n" +
+			"60/VPN:me            000002\n", ""},
+		{[]string{"oath", "accounts", "code", "counter"}, exitOK, "counter  000003\n", ""},
+		{[]string{"oath", "accounts", "code", "touchy", "-s"}, exitOK, "000004\n", "Touch your YubiKey...\n"},
+		{[]string{"oath", "accounts", "code", "-s", "me"}, exitMultipleMatches, "", "Error: Multiple matches, make the query more specific.\n"},
+		{[]string{"oath", "accounts", "code", "me"}, exitOK, "GitHub:me  000001\n60/VPN:me  000002\n", ""},
+		{[]string{"oath", "accounts", "code", "-s", "gitlab"}, exitNoMatch, "", "Error: No matching account found.\n"},
+		{[]string{"oath", "accounts", "code", "gitlab"}, exitOK, "", ""},
+		{[]string{"oath", "accounts", "code", "60"}, exitOK, "", ""},
+		{[]string{"oath", "accounts", "code", "VPN:me"}, exitOK, "60/VPN:me  000002\n", ""},
+		{[]string{"oath", "accounts", "code", "secret"}, exitOK, "", ""},
+		{[]string{"oath", "accounts", "code", "-H", "secret"}, exitOK, "_hidden:secret  000005\n", ""},
+		{[]string{"oath", "accounts"}, exitUsage, "", "Error: usage: " + usageOath + "\n"},
+	} {
+
+		c, stdout, stderr := testYkmanCLI()
+
+		assert.Equal(test.Code, c.runYkman(test.Args), fmt.Sprint(test.Args))
+		assert.Equal(test.Stdout, stdout.String(), fmt.Sprint(test.Args))
+		assert.Equal(test.Stderr, stderr.String(), fmt.Sprint(test.Args))
+
+	}
+
+	c, stdout, _ := testYkmanCLI()
+
+	assert.Equal(exitOK, c.run([]string{"oath", "accounts", "code", "-s", "github"}))
+	assert.Equal("000001\n", stdout.String())
+
+	assert.True(isYkman("ykman"))
+	assert.True(isYkman("ykman.exe"))
+	assert.False(isYkman("ykoath"))
+
+}
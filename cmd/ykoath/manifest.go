@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yawn/ykoath/manifest"
+)
+
+const errApplyAborted = "apply aborted"
+
+// runPlan prints the steps applying a manifest would execute
+func runPlan(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageError(usagePlan)
+	}
+
+	m, err := c.readManifest(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	steps, err := m.Plan(o)
+
+	if err != nil {
+		return err
+	}
+
+	return c.emit(&document{Steps: steps}, func(w io.Writer) error {
+		return c.writeSteps(w, steps)
+	})
+
+}
+
+// runApply changes the credentials of the device to a manifest, asking for
+// confirmation before deleting or overwriting credentials. A manifest read
+// from stdin requires -f, since stdin cannot answer the confirmation as well.
+func runApply(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	force := flags.Bool("f", false, "do not ask for confirmation")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageError(usageApply)
+	}
+
+	if flags.Arg(0) == "-" && !*force {
+		return usageError(usageApplyStdin)
+	}
+
+	m, err := c.readManifest(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	o, err := c.session()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	steps, err := m.Plan(o)
+
+	if err != nil {
+		return err
+	}
+
+	if destructive(steps) && !*force {
+
+		c.writeSteps(c.stderr, steps)
+		fmt.Fprint(c.stderr, "This deletes or overwrites credentials. Continue? [y/N] ")
+
+		answer, _ := bufio.NewReader(c.stdin).ReadString('\n')
+
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			return fmt.Errorf(errApplyAborted)
+		}
+
+	}
+
+	if err := manifest.Apply(o, steps); err != nil {
+		return err
+	}
+
+	return c.emit(&document{Steps: steps}, func(w io.Writer) error {
+		return c.writeSteps(w, steps)
+	})
+
+}
+
+// readManifest parses a manifest file ("-" for stdin)
+func (c *cli) readManifest(path string) (*manifest.Manifest, error) {
+
+	var (
+		buf []byte
+		err error
+	)
+
+	if path == "-" {
+		buf, err = io.ReadAll(c.stdin)
+	} else {
+		buf, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest.Parse(buf)
+
+}
+
+// writeSteps prints the steps of a plan
+func (c *cli) writeSteps(w io.Writer, steps []*manifest.Step) error {
+
+	if len(steps) == 0 {
+		_, err := fmt.Fprintln(c.stderr, "No changes")
+		return err
+	}
+
+	for _, step := range steps {
+		fmt.Fprintln(w, step)
+	}
+
+	return nil
+
+}
+
+// destructive indicates steps deleting or overwriting credentials
+func destructive(steps []*manifest.Step) bool {
+
+	for _, step := range steps {
+
+		if step.Action == manifest.Delete || step.Action == manifest.Update {
+			return true
+		}
+
+	}
+
+	return false
+
+}
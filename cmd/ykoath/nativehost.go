@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yawn/ykoath/nativehost"
+)
+
+// nativeHostCommand is the name to invoke the CLI as native messaging host
+// under (e.g. through a symlink), since browsers cannot pass arguments
+const nativeHostCommand = "ykoath-native-host"
+
+// runNativeHost serves a browser extension over stdin and stdout. Arguments
+// passed by the browser (the origin of the extension) are ignored.
+func runNativeHost(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("native-host", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	config := flags.String("config", defaultConfig(), "origin mapping")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	mapping, err := nativehost.LoadConfig(*config)
+
+	if err != nil {
+		return err
+	}
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	return nativehost.New(o, mapping).Serve(c.stdin, c.stdout)
+
+}
+
+// defaultConfig returns the path of the origin mapping in the user's config
+// directory
+func defaultConfig() string {
+
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		dir = "."
+	}
+
+	return filepath.Join(dir, "ykoath", "origins.json")
+
+}
+
+// isNativeHost indicates an invocation as native messaging host
+func isNativeHost(command string) bool {
+	return strings.TrimSuffix(command, ".exe") == nativeHostCommand
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/yawn/ykoath"
+	"github.com/yawn/ykoath/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputJSON = "json"
+	outputText = "text"
+	outputYAML = "yaml"
+
+	errUnknownOutput = "unknown output format %q (use text, json or yaml)"
+)
+
+// document is the structured output of a command, following the JSON schema
+// of the package types (see ykoath.SchemaVersion). Collections are pointers,
+// so they are omitted by commands not returning them but emitted as [] when
+// empty.
+type document struct {
+	Schema      int                  `json:"schema"`
+	Code        *ykoath.Code         `json:"code,omitempty"`
+	Codes       *[]*ykoath.Code      `json:"codes,omitempty"`
+	Credential  *ykoath.Credential   `json:"credential,omitempty"`
+	Credentials *[]ykoath.Credential `json:"credentials,omitempty"`
+	Device      *ykoath.Select       `json:"device,omitempty"`
+	Error       *ykoath.ErrorInfo    `json:"error,omitempty"`
+	Serial      string               `json:"serial,omitempty"`
+	Steps       []*manifest.Step     `json:"steps,omitempty"`
+}
+
+// parseOutput validates an output format
+func parseOutput(v string) (string, error) {
+
+	switch v {
+	case outputJSON, outputText, outputYAML:
+		return v, nil
+	}
+
+	return "", fmt.Errorf(errUnknownOutput, v)
+
+}
+
+// emit writes a document in the selected structured format or calls text to
+// write the human readable output
+func (c *cli) emit(doc *document, text func(w io.Writer) error) error {
+
+	if !c.structured() {
+		return text(c.stdout)
+	}
+
+	doc.Schema = ykoath.SchemaVersion
+
+	return encode(c.stdout, c.output, doc)
+
+}
+
+// structured indicates JSON or YAML output
+func (c *cli) structured() bool {
+	return c.output == outputJSON || c.output == outputYAML
+}
+
+// encode writes a value as JSON or YAML. YAML is converted from the JSON
+// representation, so both formats share the same schema.
+func encode(w io.Writer, format string, v interface{}) error {
+
+	buf, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	if format == outputJSON {
+		_, err := fmt.Fprintf(w, "%s\n", buf)
+		return err
+	}
+
+	var node yaml.Node
+
+	if err := yaml.Unmarshal(buf, &node); err != nil {
+		return err
+	}
+
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+
+	return enc.Close()
+
+}
+
+// blockStyle resets the (flow) style of nodes decoded from JSON
+func blockStyle(node *yaml.Node) {
+
+	node.Style = 0
+
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+
+}
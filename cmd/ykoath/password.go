@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	envNewPassword = "YKOATH_NEW_PASSWORD"
+
+	errPasswordMismatch = "passwords do not match"
+)
+
+// runPassword sets, clears or checks the password of the device
+func runPassword(c *cli, args []string) error {
+
+	if len(args) != 1 {
+		return usageError(usagePassword)
+	}
+
+	switch args[0] {
+	case "set", "clear", "unlock":
+	default:
+		return usageError(usagePassword)
+	}
+
+	o, protected, err := c.unlockedSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	var message string
+
+	switch args[0] {
+
+	case "set":
+
+		password, err := c.newPassword()
+
+		if err != nil {
+			return err
+		}
+
+		if err := o.SetPassword([]byte(password)); err != nil {
+			return err
+		}
+
+		message = "Password set"
+
+	case "clear":
+
+		if err := o.ClearPassword(); err != nil {
+			return err
+		}
+
+		message = "Password cleared"
+
+	case "unlock":
+
+		if protected {
+			message = "Password is correct"
+		} else {
+			message = "Key is not password protected"
+		}
+
+	}
+
+	return c.emit(&document{}, func(io.Writer) error {
+		_, err := fmt.Fprintln(c.stderr, message)
+		return err
+	})
+
+}
+
+// newPassword returns the new password from the environment or prompts for
+// it twice
+func (c *cli) newPassword() (string, error) {
+
+	if password := os.Getenv(envNewPassword); password != "" {
+		return password, nil
+	}
+
+	password, err := c.readPassword("New password: ", "")
+
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := c.readPassword("Repeat new password: ", "")
+
+	if err != nil {
+		return "", err
+	}
+
+	if password != confirmation {
+		return "", fmt.Errorf(errPasswordMismatch)
+	}
+
+	return password, nil
+
+}
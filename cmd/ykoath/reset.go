@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const errResetAborted = "reset aborted"
+
+// runReset removes all credentials and the password of the device
+func runReset(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	force := flags.Bool("f", false, "do not ask for confirmation")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return usageError(usageReset)
+	}
+
+	if !*force {
+
+		fmt.Fprint(c.stderr, "This removes all OATH credentials and the password. Continue? [y/N] ")
+
+		answer, _ := bufio.NewReader(c.stdin).ReadString('\n')
+
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			return fmt.Errorf(errResetAborted)
+		}
+
+	}
+
+	// resetting does not require the device to be unlocked
+	o, err := c.open(c.serials)
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	if _, err := o.Select(); err != nil {
+		return err
+	}
+
+	if err := o.Reset(); err != nil {
+		return err
+	}
+
+	return c.emit(&document{}, func(io.Writer) error {
+		_, err := fmt.Fprintln(c.stderr, "Reset OATH application")
+		return err
+	})
+
+}
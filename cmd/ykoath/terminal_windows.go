@@ -0,0 +1,20 @@
+package main
+
+import "os"
+
+// openTerminal opens the console, since Windows has no /dev/tty and reads and
+// writes it through separate handles
+func openTerminal() (in, out *os.File, err error) {
+
+	if in, err = os.OpenFile("CONIN$", os.O_RDWR, 0); err != nil {
+		return nil, nil, err
+	}
+
+	if out, err = os.OpenFile("CONOUT$", os.O_WRONLY, 0); err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+
+	return in, out, nil
+
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yawn/ykoath"
+	"golang.org/x/term"
+)
+
+const (
+	tuiBar    = 10
+	tuiPoll   = time.Second
+	tuiRedraw = 250 * time.Millisecond
+
+	errNoTerminal = "tui requires a terminal"
+)
+
+// tuiMatchers are the matching strategies of the search, cycled with tab
+var tuiMatchers = []struct {
+	name    string
+	matcher ykoath.Matcher
+}{
+	{"exact then substring", ykoath.MatchExactThenSubstring},
+	{"substring", ykoath.MatchSubstring},
+	{"prefix", ykoath.MatchPrefix},
+	{"issuer:account", ykoath.MatchIssuerAccount},
+	{"glob", ykoath.MatchGlob},
+	{"regexp", ykoath.MatchRegexp},
+	{"exact", ykoath.MatchExact},
+}
+
+// tuiDevice is a key subscribed to by the TUI
+type tuiDevice struct {
+	cancel func()
+	label  string
+}
+
+// tuiEntry is a credential on a key shown by the TUI
+type tuiEntry struct {
+	copy   bool
+	device string
+	update ykoath.CodeUpdate
+}
+
+// tuiUpdate is a code update of a key
+type tuiUpdate struct {
+	device string
+	ykoath.CodeUpdate
+}
+
+// tuiModel holds the state of the TUI independent of the terminal. Codes are
+// copied with OSC 52 escape sequences written to out.
+type tuiModel struct {
+	cursor  int
+	entries map[string]*tuiEntry
+	matcher int
+	now     func() time.Time
+	out     io.Writer
+	query   string
+	request func(e *tuiEntry)
+	status  string
+}
+
+// runTUI shows the codes of all keys with live countdowns
+func runTUI(c *cli, args []string) error {
+
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return usageError(usageTUI)
+	}
+
+	tty, ok := c.stdin.(*os.File)
+
+	if !ok || !term.IsTerminal(int(tty.Fd())) {
+		return errors.New(errNoTerminal)
+	}
+
+	fd := int(tty.Fd())
+
+	state, err := term.MakeRaw(fd)
+
+	if err != nil {
+		return err
+	}
+
+	defer term.Restore(fd, state)
+
+	// alternate screen, hidden cursor
+	fmt.Fprint(c.stdout, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(c.stdout, "\x1b[?25h\x1b[?1049l")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		devices  = make(map[string]*tuiDevice)
+		ignored  = make(map[string]bool)
+		keys     = make(chan []byte)
+		poll     = time.NewTicker(tuiPoll)
+		redraw   = time.NewTicker(tuiRedraw)
+		statuses = make(chan string)
+		updates  = make(chan tuiUpdate)
+	)
+
+	defer poll.Stop()
+	defer redraw.Stop()
+
+	model := &tuiModel{
+		entries: make(map[string]*tuiEntry),
+		now:     time.Now,
+		out:     c.stdout,
+		request: func(e *tuiEntry) {
+
+			go e.update.Request(func(name string) error {
+
+				select {
+				case statuses <- fmt.Sprintf("Touch your YubiKey (%s) to calculate %s...", e.device, name):
+				case <-ctx.Done():
+				}
+
+				return nil
+
+			})
+
+		},
+	}
+
+	go func() {
+
+		defer close(keys)
+
+		for {
+
+			buf := make([]byte, 64)
+			n, err := tty.Read(buf)
+
+			if err != nil {
+				return
+			}
+
+			select {
+			case keys <- buf[:n]:
+			case <-ctx.Done():
+				return
+			}
+
+		}
+
+	}()
+
+	for {
+
+		c.plug(ctx, model, devices, ignored, updates)
+
+	draw:
+		for {
+
+			width, height, err := term.GetSize(fd)
+
+			if err != nil {
+				width, height = 80, 24
+			}
+
+			var buf bytes.Buffer
+
+			model.render(&buf, width, height)
+			c.stdout.Write(buf.Bytes())
+
+			select {
+			case input, ok := <-keys:
+				if !ok || model.key(input) {
+					return nil
+				}
+			case u := <-updates:
+				model.update(u.device, u.CodeUpdate)
+			case status := <-statuses:
+				model.status = status
+			case <-poll.C:
+				break draw
+			case <-redraw.C:
+			}
+
+		}
+
+	}
+
+}
+
+// plug subscribes to keys plugged in since the last call and forgets removed
+// keys
+func (c *cli) plug(ctx context.Context, model *tuiModel, devices map[string]*tuiDevice, ignored map[string]bool, updates chan<- tuiUpdate) {
+
+	readers, err := ykoath.ListReaders()
+
+	if err != nil {
+		model.status = err.Error()
+		return
+	}
+
+	for reader, device := range devices {
+
+		if !slices.Contains(readers, reader) {
+			device.cancel()
+			model.remove(device.label)
+			delete(devices, reader)
+		}
+
+	}
+
+	for reader := range ignored {
+
+		if !slices.Contains(readers, reader) {
+			delete(ignored, reader)
+		}
+
+	}
+
+	for _, reader := range readers {
+
+		if devices[reader] != nil || ignored[reader] {
+			continue
+		}
+
+		o, label, err := c.openReader(reader)
+
+		if err != nil {
+			model.status = fmt.Sprintf("%s: %v", label, err)
+		}
+
+		if o == nil {
+			ignored[reader] = true
+			continue
+		}
+
+		sub, cancel := context.WithCancel(ctx)
+
+		devices[reader] = &tuiDevice{
+			cancel: cancel,
+			label:  label,
+		}
+
+		go func() {
+
+			// the session is closed once the subscription ended
+			defer o.Close()
+
+			for u := range o.Subscribe(sub, "") {
+
+				select {
+				case updates <- tuiUpdate{label, u}:
+				case <-sub.Done():
+				}
+
+			}
+
+		}()
+
+	}
+
+}
+
+// openReader opens and unlocks the key in a reader, returning no session for
+// keys not selected with --serial or that cannot be unlocked
+func (c *cli) openReader(reader string) (*ykoath.OATH, string, error) {
+
+	o, err := ykoath.NewFromReader(reader)
+
+	if err != nil {
+		return nil, reader, err
+	}
+
+	label := reader
+
+	if serial, err := o.Serial(); err == nil {
+		label = serial
+	}
+
+	if len(c.serials) > 0 && !slices.Contains(c.serials, label) {
+		o.Close()
+		return nil, label, nil
+	}
+
+	s, err := o.Select()
+
+	if err == nil && s.IsLocked() {
+
+		if c.password == "" {
+			err = fmt.Errorf(errAuthRequired, envPassword)
+		} else {
+			err = o.Unlock([]byte(c.password))
+		}
+
+	}
+
+	if err != nil {
+		o.Close()
+		return nil, label, err
+	}
+
+	return o, label, nil
+
+}
+
+// update records a code of a key
+func (m *tuiModel) update(device string, u ykoath.CodeUpdate) {
+
+	if u.Code == nil {
+		m.status = fmt.Sprintf("%s: %v", device, u.Err)
+		return
+	}
+
+	key := device + "\x00" + u.Code.Name
+	e := m.entries[key]
+
+	if u.Err != nil {
+
+		m.status = fmt.Sprintf("%s: %v", u.Code.Name, u.Err)
+
+		if e != nil {
+			e.copy = false
+			return
+		}
+
+	}
+
+	if e == nil {
+		e = &tuiEntry{device: device}
+		m.entries[key] = e
+	}
+
+	e.update = u
+
+	if e.copy && !u.Pending && u.Code.Value != "" {
+		e.copy = false
+		m.copy(e)
+	}
+
+}
+
+// remove forgets the codes of a key
+func (m *tuiModel) remove(device string) {
+
+	for key, e := range m.entries {
+
+		if e.device == device {
+			delete(m.entries, key)
+		}
+
+	}
+
+}
+
+// visible returns the entries matching the search, sorted by name and key
+func (m *tuiModel) visible() ([]*tuiEntry, error) {
+
+	var (
+		entries []*tuiEntry
+		names   []string
+	)
+
+	for _, e := range m.entries {
+
+		if !slices.Contains(names, e.update.Code.Name) {
+			names = append(names, e.update.Code.Name)
+		}
+
+	}
+
+	sort.Strings(names)
+
+	if m.query != "" {
+
+		var err error
+
+		if names, err = tuiMatchers[m.matcher].matcher(m.query, names); err != nil {
+			return nil, err
+		}
+
+	}
+
+	for _, e := range m.entries {
+
+		if slices.Contains(names, e.update.Code.Name) {
+			entries = append(entries, e)
+		}
+
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+
+		if a, b := entries[i].update.Code.Name, entries[j].update.Code.Name; a != b {
+			return a < b
+		}
+
+		return entries[i].device < entries[j].device
+
+	})
+
+	return entries, nil
+
+}
+
+// key handles input, returning true to quit
+func (m *tuiModel) key(input []byte) bool {
+
+	for len(input) > 0 {
+
+		switch {
+		case bytes.HasPrefix(input, []byte("\x1b[A")):
+			m.cursor--
+			input = input[3:]
+			continue
+		case bytes.HasPrefix(input, []byte("\x1b[B")):
+			m.cursor++
+			input = input[3:]
+			continue
+		case bytes.HasPrefix(input, []byte("\x1b[")):
+
+			// skip other escape sequences (up to the final byte)
+			idx := bytes.IndexFunc(input[2:], func(r rune) bool {
+				return r >= 0x40 && r <= 0x7e
+			})
+
+			if idx < 0 {
+				return false
+			}
+
+			input = input[idx+3:]
+			continue
+
+		}
+
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+
+		switch r {
+		case 0x03, 0x04:
+			return true
+		case '\t':
+			m.matcher = (m.matcher + 1) % len(tuiMatchers)
+		case '\r', '\n':
+			m.enter()
+		case 0x7f, 0x08:
+			if len(m.query) > 0 {
+				_, size := utf8.DecodeLastRuneInString(m.query)
+				m.query = m.query[:len(m.query)-size]
+			}
+		case 0x15, 0x1b:
+			m.query = ""
+		default:
+			if r >= 0x20 && r != utf8.RuneError {
+				m.query += string(r)
+			}
+		}
+
+	}
+
+	return false
+
+}
+
+// enter copies the selected code, requesting it first if it is pending
+func (m *tuiModel) enter() {
+
+	entries, _ := m.visible()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	e := entries[m.clamp(len(entries))]
+
+	if !e.update.Pending && e.update.Code.Value != "" {
+		m.copy(e)
+		return
+	}
+
+	e.copy = true
+	m.status = fmt.Sprintf("Calculating %s...", e.update.Code.Name)
+	m.request(e)
+
+}
+
+// copy copies the code of an entry with an OSC 52 escape sequence
+func (m *tuiModel) copy(e *tuiEntry) {
+
+	fmt.Fprintf(m.out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(e.update.Code.Value)))
+	m.status = fmt.Sprintf("Copied %s", e.update.Code.Name)
+
+}
+
+// clamp keeps the cursor within a number of entries and returns it
+func (m *tuiModel) clamp(entries int) int {
+
+	m.cursor = max(0, min(m.cursor, entries-1))
+
+	return m.cursor
+
+}
+
+// render draws the TUI on a terminal of the given size
+func (m *tuiModel) render(w io.Writer, width, height int) {
+
+	var (
+		lines  []string
+		name   int
+		now    = m.now()
+		rows   = max(1, height-2)
+		search = fmt.Sprintf("Search (%s): %s", tuiMatchers[m.matcher].name, m.query)
+		status = m.status
+	)
+
+	entries, err := m.visible()
+
+	if err != nil {
+		search += "  (invalid query)"
+	}
+
+	if status == "" {
+		status = "up/down select  enter copy (touch)  tab matcher  ctrl-u clear  ctrl-c quit"
+	}
+
+	lines = append(lines, search)
+
+	for _, e := range entries {
+		name = max(name, utf8.RuneCountInString(e.update.Code.Name))
+	}
+
+	cursor := m.clamp(len(entries))
+	offset := max(0, cursor-rows+1)
+
+	for idx := offset; idx < len(entries) && idx < offset+rows; idx++ {
+
+		var (
+			code   = entries[idx].update.Code
+			marker = "  "
+			value  = code.Value
+		)
+
+		if idx == cursor {
+			marker = "> "
+		}
+
+		switch {
+		case entries[idx].update.Pending && code.Type == ykoath.Hotp:
+			value = "[HOTP]"
+		case entries[idx].update.Pending:
+			value = "[Touch]"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s%-*s  %-8s  %-16s  %s", marker, name, code.Name, value, countdown(code, now), entries[idx].device))
+
+	}
+
+	for len(lines) < rows+1 {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, status)
+
+	fmt.Fprint(w, "\x1b[H")
+
+	for idx, line := range lines {
+
+		if idx > 0 {
+			fmt.Fprint(w, "\r\n")
+		}
+
+		fmt.Fprintf(w, "%s\x1b[K", truncate(line, width))
+
+	}
+
+	fmt.Fprint(w, "\x1b[J")
+
+}
+
+// countdown returns a bar and the seconds left in the window of a TOTP code
+func countdown(code *ykoath.Code, now time.Time) string {
+
+	if code.Type != ykoath.Totp || code.Period == 0 || code.ValidTo.IsZero() {
+		return ""
+	}
+
+	left := max(0, code.ValidTo.Sub(now))
+	filled := min(tuiBar, int((left*tuiBar+time.Duration(code.Period)*time.Second-1)/(time.Duration(code.Period)*time.Second)))
+
+	return fmt.Sprintf("[%s%s] %2ds", strings.Repeat("#", filled), strings.Repeat("-", tuiBar-filled), int(left.Round(time.Second)/time.Second))
+
+}
+
+// truncate cuts a line to a number of runes
+func truncate(line string, width int) string {
+
+	if width <= 0 || utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	return string([]rune(line)[:width])
+
+}
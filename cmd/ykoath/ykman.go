@@ -0,0 +1,432 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yawn/ykoath"
+)
+
+const (
+	ykmanHidden  = "_hidden"
+	ykmanHOTP    = "[HOTP Account]"
+	ykmanTouch   = "[Requires Touch]"
+	ykmanUsage   = "ykman [--device serial] oath accounts code|list [options]"
+	ykmanCommand = "ykman"
+
+	errYkmanMultipleMatches = "Multiple matches, make the query more specific."
+	errYkmanNoMatch         = "No matching account found."
+	errYkmanTouchTimeout    = "Touch account timed out!"
+)
+
+// ykmanError is an error with the message ykman prints for it, keeping the
+// underlying error for the exit code
+type ykmanError struct {
+	err     error
+	message string
+}
+
+func (y *ykmanError) Error() string {
+	return y.message
+}
+
+func (y *ykmanError) Unwrap() error {
+	return y.err
+}
+
+// runYkman runs the CLI as drop-in replacement for ykman (when invoked as
+// "ykman"), parsing ykman's global options
+func (c *cli) runYkman(args []string) int {
+
+	c.compat = true
+
+	flags := flag.NewFlagSet(ykmanCommand, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: %s\n", ykmanUsage)
+	}
+
+	device := func(v string) error {
+		c.serials = append(c.serials, v)
+		return nil
+	}
+
+	flags.Func("device", "serial of the device to use", device)
+	flags.Func("d", "serial of the device to use", device)
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.Arg(0) != "oath" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	err := runOath(c, flags.Args()[1:])
+
+	if err != nil {
+		c.fail(err)
+	}
+
+	return exitCode(err)
+
+}
+
+// runOath implements the "oath accounts" commands of ykman with the same
+// options, output and query semantics
+func runOath(c *cli, args []string) error {
+
+	c.compat = true
+
+	if len(args) < 2 || args[0] != "accounts" {
+		return usageError(usageOath)
+	}
+
+	switch args[1] {
+	case "code":
+		return runOathCode(c, args[2:])
+	case "list":
+		return runOathList(c, args[2:])
+	}
+
+	return usageError(usageOath)
+
+}
+
+// runOathList lists the credentials like "ykman oath accounts list"
+func runOathList(c *cli, args []string) error {
+
+	var (
+		flags    = flag.NewFlagSet("list", flag.ContinueOnError)
+		hidden   = boolFlag(flags, false, "include hidden accounts", "show-hidden", "H")
+		oathType = boolFlag(flags, false, "display the OATH type", "oath-type", "o")
+		period   = boolFlag(flags, false, "display the period", "period", "P")
+	)
+
+	flags.SetOutput(c.stderr)
+	ykmanPassword(c, flags)
+
+	positional, err := parseInterspersed(flags, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return usageError(usageOath)
+	}
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	names, err := o.List()
+
+	if err != nil {
+		return err
+	}
+
+	var credentials []ykoath.Credential
+
+	for _, name := range names {
+
+		if credential := name.Credential(); *hidden || credential.Issuer != ykmanHidden {
+			credentials = append(credentials, credential)
+		}
+
+	}
+
+	sortYkman(credentials)
+
+	for _, credential := range credentials {
+
+		line := []string{credential.Name}
+
+		if *oathType {
+			line = append(line, credential.Type.String())
+		}
+
+		if *period {
+			line = append(line, strconv.Itoa(credential.Period))
+		}
+
+		fmt.Fprintln(c.stdout, strings.Join(line, ", "))
+
+	}
+
+	return nil
+
+}
+
+// runOathCode calculates codes like "ykman oath accounts code": all
+// credentials matching the query are shown, calculating a single match even
+// if it requires touch or is a HOTP credential
+func runOathCode(c *cli, args []string) error {
+
+	var (
+		flags  = flag.NewFlagSet("code", flag.ContinueOnError)
+		hidden = boolFlag(flags, false, "include hidden accounts", "show-hidden", "H")
+		single = boolFlag(flags, false, "print the code only", "single", "s")
+	)
+
+	flags.SetOutput(c.stderr)
+	ykmanPassword(c, flags)
+
+	positional, err := parseInterspersed(flags, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(positional) > 1 {
+		return usageError(usageOath)
+	}
+
+	o, err := c.readSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer o.Close()
+
+	t := o.Clock()
+
+	all, err := o.CalculateAllAt(t)
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		codes   = make(map[string]*ykoath.Code, len(all))
+		labels  []string
+		names   []string
+		byLabel = make(map[string][]string, len(all))
+	)
+
+	for _, code := range all {
+
+		credential := (&ykoath.Name{Name: code.Name, Type: code.Type}).Credential()
+
+		if *hidden || credential.Issuer != ykmanHidden {
+
+			label := ykmanLabel(credential)
+
+			if _, ok := byLabel[label]; !ok {
+				labels = append(labels, label)
+			}
+
+			codes[code.Name] = code
+			names = append(names, code.Name)
+			byLabel[label] = append(byLabel[label], code.Name)
+
+		}
+
+	}
+
+	// like ykman, queries match issuer and account without the period prefix
+	if len(positional) == 1 {
+
+		matches, _ := ykoath.MatchExactThenSubstring(positional[0], labels)
+
+		names = nil
+
+		for _, match := range matches {
+			names = append(names, byLabel[match]...)
+		}
+
+	}
+
+	switch {
+	case len(names) == 1:
+
+		code := codes[names[0]]
+
+		if code.Touch || code.Type == ykoath.Hotp {
+
+			if code, err = o.CalculateAt(code.Name, t, c.touchYkman); err != nil {
+
+				if sw, _ := ykoath.StatusWord(err); sw == ykoath.StatusTouchTimeout {
+					return &ykmanError{err, errYkmanTouchTimeout}
+				}
+
+				return err
+
+			}
+
+			codes[code.Name] = code
+
+		}
+
+	case *single && len(names) > 1:
+		return &ykmanError{ykoath.ErrMultipleMatches, errYkmanMultipleMatches}
+	case *single && len(names) == 0:
+		return &ykmanError{ykoath.ErrUnknownName, errYkmanNoMatch}
+	}
+
+	if *single {
+		_, err := fmt.Fprintln(c.stdout, codes[names[0]].Value)
+		return err
+	}
+
+	credentials := make([]ykoath.Credential, len(names))
+
+	for idx, name := range names {
+		credentials[idx] = (&ykoath.Name{Name: name, Type: codes[name].Type}).Credential()
+	}
+
+	sortYkman(credentials)
+
+	return writeYkmanCodes(c.stdout, credentials, codes)
+
+}
+
+// ykmanLabel returns issuer and account of a credential as matched by ykman
+func ykmanLabel(credential ykoath.Credential) string {
+
+	if credential.Issuer == "" {
+		return credential.Account
+	}
+
+	return credential.Issuer + ":" + credential.Account
+
+}
+
+// writeYkmanCodes writes names and codes in aligned columns like ykman,
+// marking codes that have not been calculated
+func writeYkmanCodes(w io.Writer, credentials []ykoath.Credential, codes map[string]*ykoath.Code) error {
+
+	var (
+		lines      = make([][2]string, len(credentials))
+		longest    int
+		longestVal int
+	)
+
+	for idx, credential := range credentials {
+
+		code := codes[credential.Name]
+		value := code.Value
+
+		switch {
+		case value != "":
+		case code.Touch:
+			value = ykmanTouch
+		case code.Type == ykoath.Hotp:
+			value = ykmanHOTP
+		}
+
+		lines[idx] = [2]string{credential.Name, value}
+		longest = max(longest, len(credential.Name))
+		longestVal = max(longestVal, len(value))
+
+	}
+
+	for _, line := range lines {
+
+		if _, err := fmt.Fprintf(w, "%-*s  %*s\n", longest, line[0], longestVal, line[1]); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+
+}
+
+// sortYkman sorts credentials like ykman: by issuer (or account if there is
+// none), then by account, ignoring case
+func sortYkman(credentials []ykoath.Credential) {
+
+	key := func(c ykoath.Credential) string {
+
+		if c.Issuer != "" {
+			return strings.ToLower(c.Issuer)
+		}
+
+		return strings.ToLower(c.Account)
+
+	}
+
+	sort.SliceStable(credentials, func(i, j int) bool {
+
+		a, b := credentials[i], credentials[j]
+
+		if key(a) != key(b) {
+			return key(a) < key(b)
+		}
+
+		return strings.ToLower(a.Account) < strings.ToLower(b.Account)
+
+	})
+
+}
+
+// parseInterspersed parses flags before, between and after positional
+// arguments like ykman does, returning the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+
+	var positional []string
+
+	for {
+
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+
+	}
+
+}
+
+// boolFlag defines a boolean flag with several names (e.g. a long and a short
+// one)
+func boolFlag(flags *flag.FlagSet, value bool, usage string, names ...string) *bool {
+
+	p := new(bool)
+
+	for _, name := range names {
+		flags.BoolVar(p, name, value, usage)
+	}
+
+	return p
+
+}
+
+// ykmanPassword defines ykman's password option of the accounts commands.
+// Passwords given as arguments are visible in the process list and the shell
+// history, $YKOATH_PASSWORD and the terminal prompt are not.
+func ykmanPassword(c *cli, flags *flag.FlagSet) {
+
+	const usage = "password of the device (visible in the process list, prefer $" + envPassword + ")"
+
+	flags.StringVar(&c.password, "password", c.password, usage)
+	flags.StringVar(&c.password, "p", c.password, usage)
+
+}
+
+// touchYkman prompts for touching the device like ykman
+func (c *cli) touchYkman(string) error {
+	fmt.Fprintln(c.stderr, "Touch your YubiKey...")
+	return nil
+}
+
+// isYkman indicates an invocation as ykman, e.g. through a symlink
+func isYkman(command string) bool {
+	return strings.TrimSuffix(command, ".exe") == ykmanCommand
+}
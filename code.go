@@ -3,6 +3,29 @@ package ykoath
 import (
 	"bytes"
 	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// StatusAuthRequired indicates a password protected device that has not
+	// been unlocked
+	StatusAuthRequired uint16 = 0x6982
+
+	// StatusNoSpace indicates a device without space for another credential
+	StatusNoSpace uint16 = 0x6a84
+
+	// StatusNoSuchObject indicates an unknown credential
+	StatusNoSuchObject uint16 = 0x6984
+
+	// StatusTouchTimeout indicates a credential requiring touch that has not
+	// been touched in time
+	StatusTouchTimeout uint16 = 0x6985
+
+	// StatusWrongSyntax indicates a malformed instruction (or a wrong
+	// password when unlocking)
+	StatusWrongSyntax uint16 = 0x6a80
 )
 
 // code encapsulates (some) response codes from the spec
@@ -15,6 +38,12 @@ func (c code) Error() string {
 		return "wrong syntax"
 	} else if bytes.Equal(c, []byte{0x69, 0x84}) {
 		return "no such object"
+	} else if bytes.Equal(c, []byte{0x69, 0x82}) {
+		return "authentication required"
+	} else if bytes.Equal(c, []byte{0x69, 0x85}) {
+		return "touch timeout"
+	} else if bytes.Equal(c, []byte{0x6a, 0x84}) {
+		return "no space"
 	}
 
 	return fmt.Sprintf("unknown (% x)", []byte(c))
@@ -30,3 +59,26 @@ func (c code) IsMore() bool {
 func (c code) IsSuccess() bool {
 	return bytes.Equal([]byte{0x90, 00}, c)
 }
+
+// isStatus indicates an error caused by a specific status word
+func isStatus(err error, sw1, sw2 byte) bool {
+
+	var c code
+
+	return errors.As(err, &c) && bytes.Equal(c, []byte{sw1, sw2})
+
+}
+
+// StatusWord returns the status word of an error caused by the device
+// responding with an error status (wrapped with pkg/errors or fmt.Errorf)
+func StatusWord(err error) (uint16, bool) {
+
+	var c code
+
+	if !errors.As(err, &c) || len(c) != 2 {
+		return 0, false
+	}
+
+	return uint16(c[0])<<8 | uint16(c[1]), true
+
+}
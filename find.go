@@ -0,0 +1,113 @@
+package ykoath
+
+import (
+	"strconv"
+	"strings"
+)
+
+const defaultPeriod = 30
+
+// Credential describes an OATH credential, splitting its name into period,
+// issuer and account like ykman does ("[period/][issuer:]account")
+type Credential struct {
+	Account   string
+	Algorithm Algorithm
+	Issuer    string
+	Name      string
+	Period    int
+	Type      Type
+}
+
+// Find returns all credentials matching a query, using the configured
+// Matcher. Unlike Calculate, multiple (or no) matches are not an error.
+func (o *OATH) Find(query string) ([]Credential, error) {
+
+	names, err := o.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		all   = make([]string, len(names))
+		index = make(map[string]*Name, len(names))
+	)
+
+	for idx, name := range names {
+		all[idx] = name.Name
+		index[name.Name] = name
+	}
+
+	matches, err := o.match(query, all)
+
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]Credential, len(matches))
+
+	for idx, match := range matches {
+		credentials[idx] = index[match].Credential()
+	}
+
+	return credentials, nil
+
+}
+
+// Credential returns the credential described by a name
+func (n *Name) Credential() Credential {
+
+	var (
+		period = defaultPeriod
+		rest   = n.Name
+	)
+
+	// only TOTP credentials carry a period prefix
+	if n.Type == Totp {
+		period, rest = splitPeriod(n.Name)
+	}
+
+	issuer, account := splitIssuer(rest)
+
+	return Credential{
+		Account:   account,
+		Algorithm: n.Algorithm,
+		Issuer:    issuer,
+		Name:      n.Name,
+		Period:    period,
+		Type:      n.Type,
+	}
+
+}
+
+// splitPeriod splits a name into its period (or the default period) and the
+// remaining name
+func splitPeriod(name string) (int, string) {
+
+	idx := strings.IndexByte(name, '/')
+
+	if idx < 1 {
+		return defaultPeriod, name
+	}
+
+	period, err := strconv.Atoi(name[:idx])
+
+	if err != nil || period < 1 {
+		return defaultPeriod, name
+	}
+
+	return period, name[idx+1:]
+
+}
+
+// splitIssuer splits a name without period into its issuer (if any) and
+// account
+func splitIssuer(name string) (string, string) {
+
+	if idx := strings.IndexByte(name, ':'); idx > 0 {
+		return name[:idx], name[idx+1:]
+	}
+
+	return "", name
+
+}
@@ -0,0 +1,287 @@
+package importer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	aegisPasswordSlot = 1
+
+	// limits of the scrypt parameters of a slot (Aegis uses N=2^15, r=8 and
+	// p=1), bounding the memory of deriving a key to 1 GiB
+	aegisMaxN = 1 << 20
+	aegisMaxP = 16
+	aegisMaxR = 8
+
+	errFailedToDecrypt  = "failed to decrypt vault (wrong password?)"
+	errInvalidScrypt    = "unsupported scrypt parameters (N=%d, r=%d, p=%d)"
+	errInvalidVault     = "invalid Aegis vault"
+	errMissingPassword  = "vault is encrypted but no password was given"
+	errNoPasswordSlot   = "vault has no password slot"
+	errUnsupportedVault = "unsupported vault version (%d)"
+)
+
+// aegisVault is an Aegis backup
+// (https://github.com/beemdevelopment/Aegis/blob/master/docs/vault.md)
+type aegisVault struct {
+	Version int             `json:"version"`
+	Header  aegisHeader     `json:"header"`
+	DB      json.RawMessage `json:"db"`
+}
+
+type aegisHeader struct {
+	Slots  []aegisSlot  `json:"slots"`
+	Params *aegisParams `json:"params"`
+}
+
+type aegisSlot struct {
+	Key       string      `json:"key"`
+	KeyParams aegisParams `json:"key_params"`
+	N         int         `json:"n"`
+	P         int         `json:"p"`
+	R         int         `json:"r"`
+	Salt      string      `json:"salt"`
+	Type      int         `json:"type"`
+}
+
+type aegisParams struct {
+	Nonce string `json:"nonce"`
+	Tag   string `json:"tag"`
+}
+
+type aegisDB struct {
+	Entries []aegisEntry `json:"entries"`
+}
+
+type aegisEntry struct {
+	Info struct {
+		Algo    string `json:"algo"`
+		Counter uint32 `json:"counter"`
+		Digits  uint8  `json:"digits"`
+		Period  int    `json:"period"`
+		Secret  string `json:"secret"`
+	} `json:"info"`
+	Issuer string `json:"issuer"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// DecodeAegis decodes an Aegis JSON backup, decrypting it with a password if
+// it is encrypted
+func DecodeAegis(buf []byte, password []byte) ([]*Entry, error) {
+
+	var vault aegisVault
+
+	if err := json.Unmarshal(buf, &vault); err != nil {
+		return nil, errors.Wrapf(err, errInvalidVault)
+	}
+
+	if vault.Version != 1 {
+		return nil, fmt.Errorf(errUnsupportedVault, vault.Version)
+	}
+
+	plaintext := []byte(vault.DB)
+
+	if vault.Header.Params != nil {
+
+		if password == nil {
+			return nil, errors.New(errMissingPassword)
+		}
+
+		var err error
+
+		if plaintext, err = vault.decrypt(password); err != nil {
+			return nil, err
+		}
+
+	}
+
+	var db aegisDB
+
+	if err := json.Unmarshal(plaintext, &db); err != nil {
+		return nil, errors.Wrapf(err, errInvalidVault)
+	}
+
+	entries := make([]*Entry, len(db.Entries))
+
+	for idx, e := range db.Entries {
+		entries[idx] = e.entry()
+	}
+
+	return entries, nil
+
+}
+
+// decrypt decrypts the database with the master key of the first password
+// slot the password opens
+func (v *aegisVault) decrypt(password []byte) ([]byte, error) {
+
+	var db string
+
+	if err := json.Unmarshal(v.DB, &db); err != nil {
+		return nil, errors.Wrapf(err, errInvalidVault)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(db)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidVault)
+	}
+
+	found := false
+
+	for _, slot := range v.Header.Slots {
+
+		if slot.Type != aegisPasswordSlot {
+			continue
+		}
+
+		found = true
+
+		if err := slot.validate(); err != nil {
+			return nil, err
+		}
+
+		salt, err := hex.DecodeString(slot.Salt)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, errInvalidVault)
+		}
+
+		key, err := scrypt.Key(password, salt, slot.N, slot.R, slot.P, 32)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, errInvalidVault)
+		}
+
+		encrypted, err := hex.DecodeString(slot.Key)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, errInvalidVault)
+		}
+
+		master, err := open(key, slot.KeyParams, encrypted)
+
+		if err != nil {
+			continue
+		}
+
+		plaintext, err := open(master, *v.Header.Params, ciphertext)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, errFailedToDecrypt)
+		}
+
+		return plaintext, nil
+
+	}
+
+	if !found {
+		return nil, errors.New(errNoPasswordSlot)
+	}
+
+	return nil, errors.New(errFailedToDecrypt)
+
+}
+
+// entry converts an Aegis entry into an import entry
+func (e *aegisEntry) entry() *Entry {
+
+	c := &ykoath.CredentialData{
+		Account: e.Name,
+		Counter: e.Info.Counter,
+		Digits:  e.Info.Digits,
+		Issuer:  e.Issuer,
+		Period:  e.Info.Period,
+	}
+
+	entry := &Entry{
+		Credential: c,
+		Label:      e.Name,
+	}
+
+	if e.Issuer != "" {
+		entry.Label = fmt.Sprintf("%s (%s)", e.Name, e.Issuer)
+	}
+
+	switch e.Type {
+	case "totp":
+		c.Type = ykoath.Totp
+		c.Counter = 0
+	case "hotp":
+		c.Type = ykoath.Hotp
+	default:
+		entry.Err = fmt.Errorf(errUnsupportedType, e.Type)
+		return entry
+	}
+
+	switch strings.ToUpper(e.Info.Algo) {
+	case "SHA1":
+		c.Algorithm = ykoath.HmacSha1
+	case "SHA256":
+		c.Algorithm = ykoath.HmacSha256
+	case "SHA512":
+		c.Algorithm = ykoath.HmacSha512
+	default:
+		entry.Err = fmt.Errorf(errUnsupportedAlgorithm, e.Info.Algo)
+		return entry
+	}
+
+	c.Secret, entry.Err = ykoath.DecodeBase32(e.Info.Secret)
+
+	return entry
+
+}
+
+// open decrypts an AES-GCM ciphertext with a separately stored tag
+func open(key []byte, params aegisParams, ciphertext []byte) ([]byte, error) {
+
+	nonce, err := hex.DecodeString(params.Nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := hex.DecodeString(params.Tag)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, nonce, append(append([]byte(nil), ciphertext...), tag...), nil)
+
+}
+
+// validate checks the scrypt parameters of a slot before deriving a key, since
+// a crafted vault could otherwise exhaust memory
+func (s *aegisSlot) validate() error {
+
+	if s.N < 2 || s.N > aegisMaxN || s.N&(s.N-1) != 0 || s.R < 1 || s.R > aegisMaxR || s.P < 1 || s.P > aegisMaxP {
+		return fmt.Errorf(errInvalidScrypt, s.N, s.R, s.P)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,150 @@
+// Package importer imports credentials exported by other authenticators (such
+// as Google Authenticator) into an ykoath.Authenticator, reporting the outcome
+// per account.
+package importer
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+)
+
+const (
+	errCounterUnsupported   = "authenticator does not support initial counters"
+	errFirmwareTooOld       = "%s requires firmware %s or later (have %s)"
+	errUnsupportedAlgorithm = "unsupported algorithm (%v)"
+	errUnsupportedType      = "unsupported type (%v)"
+)
+
+// Entry is an account found in an export. Err is set if the account cannot be
+// represented as an OATH credential at all (e.g. MD5 based accounts).
+type Entry struct {
+	Credential *ykoath.CredentialData
+	Err        error
+	Label      string
+}
+
+// Options controls how entries are imported
+type Options struct {
+
+	// Touch stores all credentials with the touch-required bit
+	Touch bool
+
+	// Version is the firmware version of the target device (as returned by
+	// Select) and used to skip credentials it cannot hold; nil skips this
+	// check
+	Version []byte
+}
+
+// Result is the outcome of importing one entry. Skipped entries have not been
+// written because they are incompatible with the target, Err holds the reason
+// (or the error of writing the credential).
+type Result struct {
+	Entry   *Entry
+	Err     error
+	Name    string
+	Skipped bool
+}
+
+// putter is implemented by authenticators that can store initial counters
+type putter interface {
+	PutCredential(c *ykoath.CredentialData, touch bool) error
+}
+
+// Import writes every compatible entry to an authenticator, continuing after
+// failures
+func Import(a ykoath.Authenticator, entries []*Entry, opts Options) []*Result {
+
+	results := Preview(entries, opts)
+
+	for _, result := range results {
+
+		if result.Skipped {
+			continue
+		}
+
+		c := result.Entry.Credential
+
+		if p, ok := a.(putter); ok {
+			result.Err = p.PutCredential(c, opts.Touch)
+		} else if c.Counter > 0 {
+			result.Err = errors.New(errCounterUnsupported)
+			result.Skipped = true
+		} else {
+			result.Err = a.Put(result.Name, c.Algorithm, c.Type, c.Digits, c.Secret, opts.Touch)
+		}
+
+	}
+
+	return results
+
+}
+
+// Preview returns the results of an import without writing anything: the
+// names of the credentials that would be written and the entries that would
+// be skipped as incompatible with the target
+func Preview(entries []*Entry, opts Options) []*Result {
+
+	results := make([]*Result, len(entries))
+
+	for idx, entry := range entries {
+
+		result := &Result{
+			Entry: entry,
+		}
+
+		if result.Err = Check(entry, opts); result.Err != nil {
+			result.Skipped = true
+		} else {
+			result.Name = entry.Credential.Name()
+		}
+
+		results[idx] = result
+
+	}
+
+	return results
+
+}
+
+// Check returns why an entry cannot be imported with the given options, if
+// at all
+func Check(entry *Entry, opts Options) error {
+
+	if entry.Err != nil {
+		return entry.Err
+	}
+
+	if err := entry.Credential.Validate(); err != nil {
+		return err
+	}
+
+	// https://developers.yubico.com/OATH/YKOATH_Protocol.html
+	if entry.Credential.Algorithm == ykoath.HmacSha512 && opts.Version != nil && older(opts.Version, []byte{4, 3, 1}) {
+		return fmt.Errorf(errFirmwareTooOld, ykoath.HmacSha512, version([]byte{4, 3, 1}), version(opts.Version))
+	}
+
+	return nil
+
+}
+
+// older returns true if version a is older than version b
+func older(a, b []byte) bool {
+
+	for idx := 0; idx < len(a) && idx < len(b); idx++ {
+
+		if a[idx] != b[idx] {
+			return a[idx] < b[idx]
+		}
+
+	}
+
+	return len(a) < len(b)
+
+}
+
+// version formats a firmware version like ykoath.Select does
+func version(v []byte) string {
+	return (&ykoath.Select{Version: v}).VersionString()
+}
@@ -0,0 +1,366 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+	"golang.org/x/crypto/scrypt"
+)
+
+// testAuthenticator records the credentials written to it
+type testAuthenticator struct {
+	ykoath.Authenticator
+	fail        map[string]error
+	credentials map[string]*ykoath.CredentialData
+	touch       map[string]bool
+}
+
+func newTestAuthenticator() *testAuthenticator {
+
+	return &testAuthenticator{
+		fail:        make(map[string]error),
+		credentials: make(map[string]*ykoath.CredentialData),
+		touch:       make(map[string]bool),
+	}
+
+}
+
+func (t *testAuthenticator) PutCredential(c *ykoath.CredentialData, touch bool) error {
+
+	if err := t.fail[c.Name()]; err != nil {
+		return err
+	}
+
+	t.credentials[c.Name()] = c
+	t.touch[c.Name()] = touch
+
+	return nil
+
+}
+
+// field encodes a protocol buffer field
+func field(number int, value interface{}) []byte {
+
+	switch v := value.(type) {
+	case int:
+		buf := binary.AppendUvarint(nil, uint64(number<<3))
+		return binary.AppendUvarint(buf, uint64(v))
+	case string:
+		return field(number, []byte(v))
+	case []byte:
+		buf := binary.AppendUvarint(nil, uint64(number<<3|2))
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...)
+	}
+
+	panic("unsupported value")
+
+}
+
+// payload encodes a MigrationPayload as otpauth-migration URI
+func payload(size, index, id int, parameters ...[]byte) string {
+
+	var buf []byte
+
+	for _, p := range parameters {
+		buf = append(buf, field(1, p)...)
+	}
+
+	buf = append(buf, field(2, 1)...)
+	buf = append(buf, field(3, size)...)
+	buf = append(buf, field(4, index)...)
+	buf = append(buf, field(5, id)...)
+
+	return "otpauth-migration://offline?data=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf))
+
+}
+
+// parameters encodes an OtpParameters message
+func parameters(secret, name, issuer string, algorithm, digits, kind, counter int) []byte {
+
+	buf := append(field(1, secret), field(2, name)...)
+	buf = append(buf, field(3, issuer)...)
+	buf = append(buf, field(4, algorithm)...)
+	buf = append(buf, field(5, digits)...)
+	buf = append(buf, field(6, kind)...)
+
+	if counter > 0 {
+		buf = append(buf, field(7, counter)...)
+	}
+
+	return buf
+
+}
+
+const aegisDatabase = `{
+	"version": 2,
+	"entries": [
+		{"type": "totp", "name": "me", "issuer": "GitHub", "info": {"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "algo": "SHA1", "digits": 6, "period": 30}},
+		{"type": "totp", "name": "vpn", "issuer": "", "info": {"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA", "algo": "SHA256", "digits": 8, "period": 60}},
+		{"type": "hotp", "name": "counter", "issuer": "VPN", "info": {"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "algo": "SHA1", "digits": 6, "counter": 3}},
+		{"type": "steam", "name": "steam", "issuer": "Steam", "info": {"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "algo": "SHA1", "digits": 5, "period": 30}},
+		{"type": "totp", "name": "md5", "issuer": "", "info": {"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "algo": "MD5", "digits": 6, "period": 30}}
+	]
+}`
+
+// seal encrypts with AES-GCM, returning the ciphertext and the parameters
+// (nonce and separate tag) like Aegis does
+func seal(t *testing.T, key, plaintext []byte) ([]byte, map[string]string) {
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	nonce := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nil, nonce, plaintext, nil)
+	tag := sealed[len(sealed)-aead.Overhead():]
+
+	return sealed[:len(sealed)-aead.Overhead()], map[string]string{
+		"nonce": hex.EncodeToString(nonce),
+		"tag":   hex.EncodeToString(tag),
+	}
+
+}
+
+// encryptedVault returns an Aegis vault encrypted with a password
+func encryptedVault(t *testing.T, password string) []byte {
+
+	var (
+		master = []byte("0123456789abcdef0123456789abcdef")
+		salt   = []byte("salty")
+	)
+
+	key, err := scrypt.Key([]byte(password), salt, 1024, 8, 1, 32)
+	require.NoError(t, err)
+
+	db, params := seal(t, master, []byte(aegisDatabase))
+	slotKey, slotParams := seal(t, key, master)
+
+	buf, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"header": map[string]interface{}{
+			"slots": []interface{}{
+				map[string]interface{}{"type": 2, "key": "00"},
+				map[string]interface{}{
+					"type":       1,
+					"key":        hex.EncodeToString(slotKey),
+					"key_params": slotParams,
+					"n":          1024,
+					"r":          8,
+					"p":          1,
+					"salt":       hex.EncodeToString(salt),
+				},
+			},
+			"params": params,
+		},
+		"db": base64.StdEncoding.EncodeToString(db),
+	})
+	require.NoError(t, err)
+
+	return buf
+
+}
+
+func TestDecodeAegis(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		plain   = []byte(`{"version": 1, "header": {"slots": null, "params": null}, "db": ` + aegisDatabase + `}`)
+	)
+
+	for _, test := range []struct {
+		Name     string
+		Vault    []byte
+		Password []byte
+	}{
+		{"plain", plain, nil},
+		{"encrypted", encryptedVault(t, "secret"), []byte("secret")},
+	} {
+
+		entries, err := DecodeAegis(test.Vault, test.Password)
+		require.NoError(err, test.Name)
+		require.Len(entries, 5)
+
+		assert.Equal(&ykoath.CredentialData{
+			Account:   "vpn",
+			Algorithm: ykoath.HmacSha256,
+			Digits:    8,
+			Period:    60,
+			Secret:    []byte("12345678901234567890123456789012"),
+			Type:      ykoath.Totp,
+		}, entries[1].Credential)
+
+		assert.Equal("me (GitHub)", entries[0].Label)
+		assert.Equal("60/vpn", entries[1].Credential.Name())
+		assert.EqualValues(3, entries[2].Credential.Counter)
+		assert.Error(entries[3].Err)
+		assert.Error(entries[4].Err)
+
+	}
+
+	_, err := DecodeAegis(encryptedVault(t, "secret"), []byte("wrong"))
+	assert.Error(err)
+
+	_, err = DecodeAegis(encryptedVault(t, "secret"), nil)
+	assert.Error(err)
+
+	// scrypt parameters of a crafted vault must not exhaust memory
+	for _, n := range []string{`"n":1073741824`, `"n":1000`} {
+
+		vault := bytes.Replace(encryptedVault(t, "secret"), []byte(`"n":1024`), []byte(n), 1)
+
+		_, err = DecodeAegis(vault, []byte("secret"))
+		assert.ErrorContains(err, "unsupported scrypt parameters", n)
+
+	}
+
+}
+
+func TestDecodeMigration(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		batch1  = payload(2, 0, 42,
+			parameters("12345678901234567890", "GitHub:me", "GitHub", 1, 1, 2, 0),
+			parameters("12345678901234567890123456789012", "me@example.com", "", 2, 2, 2, 0),
+		)
+		batch2 = payload(2, 1, 42,
+			parameters("12345678901234567890", "counter", "VPN", 1, 1, 1, 7),
+			parameters("12345678901234567890", "legacy", "", 4, 1, 2, 0),
+		)
+	)
+
+	entries, err := DecodeMigration(batch2, batch1)
+	require.NoError(err)
+	require.Len(entries, 4)
+
+	assert.Equal(&ykoath.CredentialData{
+		Account:   "me",
+		Algorithm: ykoath.HmacSha1,
+		Digits:    6,
+		Issuer:    "GitHub",
+		Period:    30,
+		Secret:    []byte("12345678901234567890"),
+		Type:      ykoath.Totp,
+	}, entries[0].Credential)
+
+	assert.Equal("me (GitHub)", entries[0].Label)
+	assert.Equal("me@example.com", entries[1].Credential.Name())
+	assert.Equal(ykoath.HmacSha256, entries[1].Credential.Algorithm)
+	assert.EqualValues(8, entries[1].Credential.Digits)
+	assert.Equal(ykoath.Hotp, entries[2].Credential.Type)
+	assert.EqualValues(7, entries[2].Credential.Counter)
+	assert.Error(entries[3].Err)
+
+	_, err = DecodeMigration(batch1)
+	assert.Error(err)
+
+	// a repeated scan does not make up for a missing batch
+	_, err = DecodeMigration(batch1, batch2, batch1)
+	assert.EqualError(err, "duplicate batch 1 of 2")
+
+	_, err = DecodeMigration(batch1, payload(2, 1, 43))
+	assert.Error(err)
+
+	_, err = DecodeMigration("otpauth-migration://offline?data=CgU%3D")
+	assert.Error(err)
+
+	_, err = DecodeMigration("otpauth://totp/me?secret=GEZDGNBVGY3TQOJQ")
+	assert.Error(err)
+
+}
+
+func TestImport(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		a       = newTestAuthenticator()
+		failure = errors.New("no space")
+	)
+
+	entries, err := DecodeMigration(payload(1, 0, 1,
+		parameters("12345678901234567890", "me", "GitHub", 1, 1, 2, 0),
+		parameters("12345678901234567890", "counter", "VPN", 1, 1, 1, 7),
+		parameters("12345678901234567890", "legacy", "", 4, 1, 2, 0),
+		parameters("12345678901234567890", strings.Repeat("x", 65), "", 1, 1, 2, 0),
+		parameters("1234567890123456789012345678901234567890123456789012345678901234", "sha512", "", 3, 1, 2, 0),
+		parameters("12345678901234567890", "full", "", 1, 1, 2, 0),
+	))
+	require.NoError(err)
+
+	a.fail["full"] = failure
+
+	results := Import(a, entries, Options{
+		Touch:   true,
+		Version: []byte{4, 2, 6},
+	})
+
+	require.Len(results, 6)
+
+	assert.NoError(results[0].Err)
+	assert.Equal("GitHub:me", results[0].Name)
+	assert.NoError(results[1].Err)
+	assert.True(results[2].Skipped)
+	assert.True(results[3].Skipped)
+	assert.True(results[4].Skipped)
+	assert.False(results[5].Skipped)
+	assert.Equal(failure, results[5].Err)
+
+	assert.Len(a.credentials, 2)
+	assert.EqualValues(7, a.credentials["VPN:counter"].Counter)
+	assert.True(a.touch["GitHub:me"])
+
+	results = Import(a, entries[4:5], Options{
+		Version: []byte{5, 4, 3},
+	})
+
+	assert.NoError(results[0].Err)
+	assert.Contains(a.credentials, "sha512")
+
+}
+
+func TestPreview(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	entries, err := DecodeAegis(encryptedVault(t, "secret"), []byte("secret"))
+	require.NoError(err)
+
+	results := Preview(entries, Options{})
+	require.Len(results, 5)
+
+	var names []string
+
+	for _, result := range results {
+
+		if !result.Skipped {
+			names = append(names, result.Name)
+		}
+
+	}
+
+	assert.Equal([]string{"GitHub:me", "60/vpn", "VPN:counter"}, names)
+	assert.Error(results[3].Err)
+	assert.Error(results[4].Err)
+
+}
@@ -0,0 +1,319 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+)
+
+const (
+	errBatchMismatch     = "batch %d of %d does not belong to batch %d"
+	errBatchMissing      = "missing batch %d of %d"
+	errDuplicateBatch    = "duplicate batch %d of %d"
+	errInvalidMigration  = "invalid migration URI"
+	errInvalidPayload    = "invalid migration payload"
+	errTruncatedPayload  = "truncated payload"
+	errUnsupportedScheme = "unsupported scheme (%s)"
+	errUnsupportedWire   = "unsupported wire type (%d)"
+)
+
+// migration is a decoded MigrationPayload message
+// (https://github.com/google/google-authenticator-android/blob/master/java/com/google/android/apps/authenticator/otp/migration.proto)
+type migration struct {
+	batchID    int64
+	batchIndex int64
+	batchSize  int64
+	entries    []*Entry
+}
+
+// DecodeMigration decodes the otpauth-migration URIs of a Google Authenticator
+// export. Exports with many accounts are split into several batches (QR
+// codes); all batches must be given exactly once, in any order.
+func DecodeMigration(uris ...string) ([]*Entry, error) {
+
+	var (
+		batches = make(map[int64]*migration)
+		first   *migration
+	)
+
+	for _, uri := range uris {
+
+		m, err := decodeMigrationURI(uri)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if first == nil {
+			first = m
+		} else if m.batchID != first.batchID || m.batchSize != first.batchSize {
+			return nil, fmt.Errorf(errBatchMismatch, m.batchIndex+1, m.batchSize, first.batchID)
+		}
+
+		if _, ok := batches[m.batchIndex]; ok {
+			return nil, fmt.Errorf(errDuplicateBatch, m.batchIndex+1, max(m.batchSize, 1))
+		}
+
+		batches[m.batchIndex] = m
+
+	}
+
+	if first == nil {
+		return nil, nil
+	}
+
+	var entries []*Entry
+
+	size := first.batchSize
+
+	// exports from older versions carry no batch information
+	if size < 1 {
+		size = 1
+	}
+
+	for idx := int64(0); idx < size; idx++ {
+
+		m, ok := batches[idx]
+
+		if !ok {
+			return nil, fmt.Errorf(errBatchMissing, idx+1, size)
+		}
+
+		entries = append(entries, m.entries...)
+
+	}
+
+	return entries, nil
+
+}
+
+// decodeMigrationURI decodes a single otpauth-migration URI
+func decodeMigrationURI(uri string) (*migration, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidMigration)
+	}
+
+	if u.Scheme != "otpauth-migration" {
+		return nil, fmt.Errorf(errUnsupportedScheme, u.Scheme)
+	}
+
+	// the data parameter is standard base64, possibly with unescaped "+"
+	data := strings.ReplaceAll(u.Query().Get("data"), " ", "+")
+
+	buf, err := base64.StdEncoding.DecodeString(data)
+
+	if err != nil {
+		buf, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidMigration)
+	}
+
+	return decodeMigration(buf)
+
+}
+
+// decodeMigration decodes a MigrationPayload message
+func decodeMigration(buf []byte) (*migration, error) {
+
+	m := new(migration)
+
+	err := decodeMessage(buf, func(field int, value uint64, data []byte) error {
+
+		switch field {
+		case 1:
+
+			entry, err := decodeParameters(data)
+
+			if err != nil {
+				return err
+			}
+
+			m.entries = append(m.entries, entry)
+
+		case 3:
+			m.batchSize = int64(value)
+		case 4:
+			m.batchIndex = int64(value)
+		case 5:
+			m.batchID = int64(value)
+		}
+
+		return nil
+
+	})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidPayload)
+	}
+
+	return m, nil
+
+}
+
+// decodeParameters decodes an OtpParameters message
+func decodeParameters(buf []byte) (*Entry, error) {
+
+	var (
+		algorithm uint64
+		digits    uint64
+		kind      uint64
+		c         = &ykoath.CredentialData{
+			Period: 30,
+		}
+	)
+
+	err := decodeMessage(buf, func(field int, value uint64, data []byte) error {
+
+		switch field {
+		case 1:
+			c.Secret = append([]byte(nil), data...)
+		case 2:
+			c.Account = string(data)
+		case 3:
+			c.Issuer = string(data)
+		case 4:
+			algorithm = value
+		case 5:
+			digits = value
+		case 6:
+			kind = value
+		case 7:
+			c.Counter = uint32(value)
+		}
+
+		return nil
+
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		Credential: c,
+		Label:      c.Account,
+	}
+
+	// names are usually "issuer:account", with the issuer repeated
+	if issuer, account, ok := strings.Cut(c.Account, ":"); ok && (c.Issuer == "" || strings.EqualFold(issuer, c.Issuer)) {
+
+		if c.Issuer == "" {
+			c.Issuer = issuer
+		}
+
+		c.Account = strings.TrimSpace(account)
+
+	}
+
+	if c.Issuer != "" {
+		entry.Label = fmt.Sprintf("%s (%s)", c.Account, c.Issuer)
+	}
+
+	switch algorithm {
+	case 0, 1:
+		c.Algorithm = ykoath.HmacSha1
+	case 2:
+		c.Algorithm = ykoath.HmacSha256
+	case 3:
+		c.Algorithm = ykoath.HmacSha512
+	default:
+		entry.Err = fmt.Errorf(errUnsupportedAlgorithm, algorithm)
+	}
+
+	switch digits {
+	case 2:
+		c.Digits = 8
+	default:
+		c.Digits = 6
+	}
+
+	switch kind {
+	case 1:
+		c.Type = ykoath.Hotp
+	case 0, 2:
+		c.Type = ykoath.Totp
+		c.Counter = 0
+	default:
+		entry.Err = fmt.Errorf(errUnsupportedType, kind)
+	}
+
+	return entry, nil
+
+}
+
+// decodeMessage walks the fields of a protocol buffer message, passing
+// varints as value and length-delimited fields as data
+func decodeMessage(buf []byte, field func(int, uint64, []byte) error) error {
+
+	for len(buf) > 0 {
+
+		key, n := binary.Uvarint(buf)
+
+		if n <= 0 {
+			return errors.New(errTruncatedPayload)
+		}
+
+		buf = buf[n:]
+
+		var (
+			value uint64
+			data  []byte
+		)
+
+		switch wire := key & 0x07; wire {
+		case 0:
+
+			if value, n = binary.Uvarint(buf); n <= 0 {
+				return errors.New(errTruncatedPayload)
+			}
+
+			buf = buf[n:]
+
+		case 1, 5:
+
+			size := 8
+
+			if wire == 5 {
+				size = 4
+			}
+
+			if len(buf) < size {
+				return errors.New(errTruncatedPayload)
+			}
+
+			buf = buf[size:]
+
+		case 2:
+
+			length, n := binary.Uvarint(buf)
+
+			if n <= 0 || uint64(len(buf)-n) < length {
+				return errors.New(errTruncatedPayload)
+			}
+
+			data = buf[n : n+int(length)]
+			buf = buf[n+int(length):]
+
+		default:
+			return fmt.Errorf(errUnsupportedWire, wire)
+		}
+
+		if err := field(int(key>>3), value, data); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+
+}
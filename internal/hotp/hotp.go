@@ -0,0 +1,42 @@
+// Package hotp implements the HMAC-based one-time password algorithm (RFC
+// 4226) shared by the root and the otp package
+package hotp
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// Truncate calculates the HMAC of a moving factor and applies the dynamic
+// truncation of RFC 4226, section 5.3
+func Truncate(h func() hash.Hash, key []byte, counter uint64) uint32 {
+
+	var (
+		mac = hmac.New(h, key)
+		msg = make([]byte, 8)
+	)
+
+	binary.BigEndian.PutUint64(msg, counter)
+	mac.Write(msg)
+
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+
+	return binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+}
+
+// Decimal encodes a truncated value as a zero-padded decimal code
+func Decimal(value uint32, digits int) string {
+
+	mod := uint32(1)
+
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+
+}
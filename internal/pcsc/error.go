@@ -0,0 +1,79 @@
+package pcsc
+
+import "fmt"
+
+const (
+	// ErrInvalidHandle indicates an invalid context or card handle
+	ErrInvalidHandle Error = 0x80100003
+
+	// ErrUnknownReader indicates an unknown reader name
+	ErrUnknownReader Error = 0x80100009
+
+	// ErrTimeout indicates an expired timeout
+	ErrTimeout Error = 0x8010000a
+
+	// ErrSharingViolation indicates a card in use by another application
+	ErrSharingViolation Error = 0x8010000b
+
+	// ErrNoSmartcard indicates a reader without a card
+	ErrNoSmartcard Error = 0x8010000c
+
+	// ErrReaderUnavailable indicates a reader that is no longer available
+	ErrReaderUnavailable Error = 0x80100017
+
+	// ErrNoService indicates that pcscd is not running
+	ErrNoService Error = 0x8010001d
+
+	// ErrNoReadersAvailable indicates that no readers are connected
+	ErrNoReadersAvailable Error = 0x8010002e
+
+	// ErrResetCard indicates a card that has been reset
+	ErrResetCard Error = 0x80100068
+
+	// ErrRemovedCard indicates a card that has been removed
+	ErrRemovedCard Error = 0x80100069
+)
+
+// Error is a PC/SC return value
+type Error uint32
+
+// Error returns a string representation of the return value
+func (e Error) Error() string {
+
+	switch e {
+	case ErrInvalidHandle:
+		return "invalid handle"
+	case ErrUnknownReader:
+		return "unknown reader"
+	case ErrTimeout:
+		return "timeout"
+	case ErrSharingViolation:
+		return "sharing violation"
+	case ErrNoSmartcard:
+		return "no smart card"
+	case ErrReaderUnavailable:
+		return "reader unavailable"
+	case ErrNoService:
+		return "service not available"
+	case ErrNoReadersAvailable:
+		return "no readers available"
+	case ErrResetCard:
+		return "card has been reset"
+	case ErrRemovedCard:
+		return "card has been removed"
+	default:
+		return fmt.Sprintf("pcsc error (%08x)", uint32(e))
+	}
+
+}
+
+// rv converts a return value into an error
+func rv(value uint32) error {
+
+	if value == 0 {
+		return nil
+	}
+
+	return Error(value)
+
+}
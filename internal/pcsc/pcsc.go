@@ -0,0 +1,432 @@
+// Package pcsc implements a minimal client for the pcsc-lite daemon (pcscd),
+// speaking its Unix socket protocol directly instead of linking libpcsclite
+// through cgo
+package pcsc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+const (
+	cmdEstablishContext = 0x01
+	cmdReleaseContext   = 0x02
+	cmdConnect          = 0x04
+	cmdReconnect        = 0x05
+	cmdDisconnect       = 0x06
+	cmdBeginTransaction = 0x07
+	cmdEndTransaction   = 0x08
+	cmdTransmit         = 0x09
+	cmdVersion          = 0x11
+	cmdGetReadersState  = 0x12
+)
+
+const (
+	// ScopeSystem establishes a context in the system scope
+	ScopeSystem Scope = 0x0002
+
+	// ShareExclusive connects to a card exclusively
+	ShareExclusive ShareMode = 0x0001
+
+	// ShareShared connects to a card shared with other applications
+	ShareShared ShareMode = 0x0002
+
+	// ProtocolT0 denotes the T=0 protocol
+	ProtocolT0 Protocol = 0x0001
+
+	// ProtocolT1 denotes the T=1 protocol
+	ProtocolT1 Protocol = 0x0002
+
+	// ProtocolAny denotes either T=0 or T=1
+	ProtocolAny = ProtocolT0 | ProtocolT1
+
+	// LeaveCard leaves the card as is on disconnect
+	LeaveCard Disposition = 0x0000
+
+	// ResetCard resets the card on disconnect
+	ResetCard Disposition = 0x0001
+)
+
+const (
+	defaultSocket      = "/run/pcscd/pcscd.comm"
+	maxReaderName      = 128
+	maxRecvLength      = 65546
+	protocolMajor      = 4
+	protocolMinor      = 4
+	socketEnv          = "PCSCLITE_CSOCK_NAME"
+	sizeofIORequest    = 8
+	errFailedToConnect = "failed to connect to pcscd (%s)"
+	errProtocol        = "pcscd protocol mismatch (server %d.%d, client %d.%d)"
+	errReaderName      = "reader name too long (%d >= %d)"
+)
+
+// Scope denotes the scope of a context
+type Scope uint32
+
+// ShareMode denotes how a card is shared with other applications
+type ShareMode uint32
+
+// Protocol denotes the transmission protocol used to talk to a card
+type Protocol uint32
+
+// Disposition denotes what happens to a card on disconnect or at the end of a
+// transaction
+type Disposition uint32
+
+// Context is a connection to pcscd. Each context uses its own socket, and
+// calls on a context and its cards are serialized.
+type Context struct {
+	conn   net.Conn
+	handle uint32
+	mu     sync.Mutex
+}
+
+// Card is a connection to a card in a reader
+type Card struct {
+	ctx      *Context
+	handle   int32
+	protocol Protocol
+}
+
+// EstablishContext connects to the pcscd socket ($PCSCLITE_CSOCK_NAME or
+// /run/pcscd/pcscd.comm) and establishes a new context
+func EstablishContext() (*Context, error) {
+
+	path := os.Getenv(socketEnv)
+
+	if path == "" {
+		path = defaultSocket
+	}
+
+	conn, err := net.Dial("unix", path)
+
+	if err != nil {
+		return nil, fmt.Errorf(errFailedToConnect, err)
+	}
+
+	ctx := &Context{
+		conn: conn,
+	}
+
+	version := struct {
+		Major int32
+		Minor int32
+		RV    uint32
+	}{
+		Major: protocolMajor,
+		Minor: protocolMinor,
+	}
+
+	if err := ctx.call(cmdVersion, &version); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if version.RV != 0 {
+		conn.Close()
+		return nil, fmt.Errorf(errProtocol, version.Major, version.Minor, protocolMajor, protocolMinor)
+	}
+
+	establish := struct {
+		Scope  uint32
+		Handle uint32
+		RV     uint32
+	}{
+		Scope: uint32(ScopeSystem),
+	}
+
+	if err := ctx.call(cmdEstablishContext, &establish); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := rv(establish.RV); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ctx.handle = establish.Handle
+
+	return ctx, nil
+
+}
+
+// Release releases the context and closes the socket
+func (c *Context) Release() error {
+
+	release := struct {
+		Handle uint32
+		RV     uint32
+	}{
+		Handle: c.handle,
+	}
+
+	err := c.call(cmdReleaseContext, &release)
+
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return rv(release.RV)
+
+}
+
+// ListReaders returns the names of all readers known to pcscd
+func (c *Context) ListReaders() ([]string, error) {
+
+	states, err := c.readersState()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var readers []string
+
+	for _, state := range states {
+
+		if name := state.name(); name != "" {
+			readers = append(readers, name)
+		}
+
+	}
+
+	if len(readers) == 0 {
+		return nil, ErrNoReadersAvailable
+	}
+
+	return readers, nil
+
+}
+
+// Connect connects to the card in a reader
+func (c *Context) Connect(reader string, mode ShareMode, proto Protocol) (*Card, error) {
+
+	if len(reader) >= maxReaderName {
+		return nil, fmt.Errorf(errReaderName, len(reader), maxReaderName)
+	}
+
+	connect := struct {
+		Context  uint32
+		Reader   [maxReaderName]byte
+		Mode     uint32
+		Protocol uint32
+		Card     int32
+		Active   uint32
+		RV       uint32
+	}{
+		Context:  c.handle,
+		Mode:     uint32(mode),
+		Protocol: uint32(proto),
+	}
+
+	copy(connect.Reader[:], reader)
+
+	if err := c.call(cmdConnect, &connect); err != nil {
+		return nil, err
+	}
+
+	if err := rv(connect.RV); err != nil {
+		return nil, err
+	}
+
+	return &Card{
+		ctx:      c,
+		handle:   connect.Card,
+		protocol: Protocol(connect.Active),
+	}, nil
+
+}
+
+// Reconnect re-establishes the connection to a card, e.g. after it has been
+// reset by another application
+func (c *Card) Reconnect(mode ShareMode, proto Protocol, disp Disposition) error {
+
+	reconnect := struct {
+		Card           int32
+		Mode           uint32
+		Protocol       uint32
+		Initialization uint32
+		Active         uint32
+		RV             uint32
+	}{
+		Card:           c.handle,
+		Mode:           uint32(mode),
+		Protocol:       uint32(proto),
+		Initialization: uint32(disp),
+	}
+
+	if err := c.ctx.call(cmdReconnect, &reconnect); err != nil {
+		return err
+	}
+
+	if err := rv(reconnect.RV); err != nil {
+		return err
+	}
+
+	c.protocol = Protocol(reconnect.Active)
+
+	return nil
+
+}
+
+// Disconnect disconnects from a card
+func (c *Card) Disconnect(disp Disposition) error {
+
+	disconnect := struct {
+		Card        int32
+		Disposition uint32
+		RV          uint32
+	}{
+		Card:        c.handle,
+		Disposition: uint32(disp),
+	}
+
+	if err := c.ctx.call(cmdDisconnect, &disconnect); err != nil {
+		return err
+	}
+
+	return rv(disconnect.RV)
+
+}
+
+// BeginTransaction acquires exclusive access to a card
+func (c *Card) BeginTransaction() error {
+
+	begin := struct {
+		Card int32
+		RV   uint32
+	}{
+		Card: c.handle,
+	}
+
+	if err := c.ctx.call(cmdBeginTransaction, &begin); err != nil {
+		return err
+	}
+
+	return rv(begin.RV)
+
+}
+
+// EndTransaction releases exclusive access to a card
+func (c *Card) EndTransaction(disp Disposition) error {
+
+	end := struct {
+		Card        int32
+		Disposition uint32
+		RV          uint32
+	}{
+		Card:        c.handle,
+		Disposition: uint32(disp),
+	}
+
+	if err := c.ctx.call(cmdEndTransaction, &end); err != nil {
+		return err
+	}
+
+	return rv(end.RV)
+
+}
+
+// Transmit sends an APDU to a card and returns the response
+func (c *Card) Transmit(cmd []byte) ([]byte, error) {
+
+	transmit := struct {
+		Card            int32
+		SendPCIProtocol uint32
+		SendPCILength   uint32
+		SendLength      uint32
+		RecvPCIProtocol uint32
+		RecvPCILength   uint32
+		RecvLength      uint32
+		RV              uint32
+	}{
+		Card:            c.handle,
+		SendPCIProtocol: uint32(c.protocol),
+		SendPCILength:   sizeofIORequest,
+		SendLength:      uint32(len(cmd)),
+		RecvPCIProtocol: uint32(c.protocol),
+		RecvPCILength:   sizeofIORequest,
+		RecvLength:      maxRecvLength,
+	}
+
+	c.ctx.mu.Lock()
+	defer c.ctx.mu.Unlock()
+
+	if err := c.ctx.write(cmdTransmit, &transmit, cmd); err != nil {
+		return nil, err
+	}
+
+	if err := c.ctx.read(&transmit); err != nil {
+		return nil, err
+	}
+
+	if err := rv(transmit.RV); err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, transmit.RecvLength)
+
+	if _, err := io.ReadFull(c.ctx.conn, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+
+}
+
+// call sends a message and reads the response into the same struct
+func (c *Context) call(command uint32, msg interface{}) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.write(command, msg, nil); err != nil {
+		return err
+	}
+
+	return c.read(msg)
+
+}
+
+// write sends a message with its header, followed by optional extra data
+func (c *Context) write(command uint32, msg interface{}, extra []byte) error {
+
+	var buf bytes.Buffer
+
+	header := struct {
+		Size    uint32
+		Command uint32
+	}{
+		Size:    uint32(binary.Size(msg)),
+		Command: command,
+	}
+
+	if err := binary.Write(&buf, binary.NativeEndian, header); err != nil {
+		return err
+	}
+
+	if err := binary.Write(&buf, binary.NativeEndian, msg); err != nil {
+		return err
+	}
+
+	buf.Write(extra)
+
+	_, err := c.conn.Write(buf.Bytes())
+
+	return err
+
+}
+
+// read reads a fixed size message
+func (c *Context) read(msg interface{}) error {
+	return binary.Read(c.conn, binary.NativeEndian, msg)
+}
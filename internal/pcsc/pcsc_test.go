@@ -0,0 +1,275 @@
+package pcsc
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer emulates the parts of pcscd's socket protocol used by the client,
+// with a single card that echoes APDUs back followed by 90 00
+type fakeServer struct {
+	mu       sync.Mutex
+	readers  [maxReaders]readerState
+	commands []uint32
+}
+
+func newFakeServer(t *testing.T, readers ...string) *fakeServer {
+
+	s := new(fakeServer)
+
+	for idx, reader := range readers {
+		copy(s.readers[idx].Name[:], reader)
+		s.readers[idx].State = readerPresent
+	}
+
+	path := filepath.Join(t.TempDir(), "pcscd.comm")
+
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { l.Close() })
+	t.Setenv(socketEnv, path)
+
+	go func() {
+		for {
+
+			conn, err := l.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+
+		}
+	}()
+
+	return s
+
+}
+
+func (s *fakeServer) setState(idx int, state uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers[idx].State = state
+	s.readers[idx].EventCounter++
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+
+	defer conn.Close()
+
+	var (
+		ne     = binary.NativeEndian
+		header struct {
+			Size    uint32
+			Command uint32
+		}
+	)
+
+	for {
+
+		if err := binary.Read(conn, ne, &header); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, header.Command)
+		s.mu.Unlock()
+
+		msg := make([]byte, header.Size)
+
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return
+		}
+
+		switch header.Command {
+
+		case cmdVersion:
+			ne.PutUint32(msg[8:], 0)
+
+		case cmdEstablishContext:
+			ne.PutUint32(msg[4:], 0x1234)
+
+		case cmdConnect:
+
+			var known bool
+
+			name := string(msg[4 : 4+maxReaderName])
+
+			s.mu.Lock()
+			for _, reader := range s.readers {
+				known = known || (reader.name() != "" && string(reader.Name[:]) == name)
+			}
+			s.mu.Unlock()
+
+			if known {
+				ne.PutUint32(msg[140:], 0x42)
+				ne.PutUint32(msg[144:], uint32(ProtocolT1))
+			} else {
+				ne.PutUint32(msg[148:], uint32(ErrUnknownReader))
+			}
+
+		case cmdGetReadersState:
+
+			s.mu.Lock()
+			states := s.readers
+			s.mu.Unlock()
+
+			if err := binary.Write(conn, ne, &states); err != nil {
+				return
+			}
+
+			continue
+
+		case cmdTransmit:
+
+			apdu := make([]byte, ne.Uint32(msg[12:]))
+
+			if _, err := io.ReadFull(conn, apdu); err != nil {
+				return
+			}
+
+			res := append(apdu, 0x90, 0x00)
+			ne.PutUint32(msg[24:], uint32(len(res)))
+
+			if _, err := conn.Write(append(msg, res...)); err != nil {
+				return
+			}
+
+			continue
+
+		}
+
+		if _, err := conn.Write(msg); err != nil {
+			return
+		}
+
+	}
+
+}
+
+func TestTransmit(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		server  = newFakeServer(t, "Yubico YubiKey OTP+FIDO+CCID 00 00")
+	)
+
+	ctx, err := EstablishContext()
+	require.NoError(err)
+
+	assert.Equal(uint32(0x1234), ctx.handle)
+
+	readers, err := ctx.ListReaders()
+	require.NoError(err)
+
+	assert.Equal([]string{"Yubico YubiKey OTP+FIDO+CCID 00 00"}, readers)
+
+	card, err := ctx.Connect(readers[0], ShareShared, ProtocolAny)
+	require.NoError(err)
+
+	assert.Equal(int32(0x42), card.handle)
+	assert.Equal(ProtocolT1, card.protocol)
+
+	require.NoError(card.BeginTransaction())
+
+	res, err := card.Transmit([]byte{0x00, 0xa1, 0x00, 0x00})
+	require.NoError(err)
+
+	assert.Equal([]byte{0x00, 0xa1, 0x00, 0x00, 0x90, 0x00}, res)
+
+	require.NoError(card.EndTransaction(LeaveCard))
+	require.NoError(card.Reconnect(ShareShared, ProtocolAny, LeaveCard))
+	require.NoError(card.Disconnect(LeaveCard))
+	require.NoError(ctx.Release())
+
+	assert.Equal([]uint32{
+		cmdVersion,
+		cmdEstablishContext,
+		cmdGetReadersState,
+		cmdConnect,
+		cmdBeginTransaction,
+		cmdTransmit,
+		cmdEndTransaction,
+		cmdReconnect,
+		cmdDisconnect,
+		cmdReleaseContext,
+	}, server.commands)
+
+}
+
+func TestConnectUnknownReader(t *testing.T) {
+
+	newFakeServer(t, "Yubico YubiKey OTP+FIDO+CCID 00 00")
+
+	ctx, err := EstablishContext()
+	require.NoError(t, err)
+
+	defer ctx.Release()
+
+	_, err = ctx.Connect("Some Other Reader", ShareShared, ProtocolAny)
+
+	assert.Equal(t, ErrUnknownReader, err)
+
+}
+
+func TestListReadersWithoutReaders(t *testing.T) {
+
+	newFakeServer(t)
+
+	ctx, err := EstablishContext()
+	require.NoError(t, err)
+
+	defer ctx.Release()
+
+	_, err = ctx.ListReaders()
+
+	assert.Equal(t, ErrNoReadersAvailable, err)
+
+}
+
+func TestGetStatusChange(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		server  = newFakeServer(t, "Yubico YubiKey OTP+FIDO+CCID 00 00")
+	)
+
+	ctx, err := EstablishContext()
+	require.NoError(err)
+
+	defer ctx.Release()
+
+	states := []ReaderState{
+		{Reader: "Yubico YubiKey OTP+FIDO+CCID 00 00", CurrentState: StateUnaware},
+	}
+
+	require.NoError(ctx.GetStatusChange(states, 0))
+
+	assert.Equal(StatePresent|StateChanged, states[0].EventState)
+
+	states[0].CurrentState = states[0].EventState
+
+	assert.Equal(ErrTimeout, ctx.GetStatusChange(states, 0))
+
+	go func() {
+		time.Sleep(pollInterval)
+		server.setState(0, readerAbsent)
+	}()
+
+	require.NoError(ctx.GetStatusChange(states, time.Minute))
+
+	assert.Equal(StateEmpty|StateChanged|1<<16, states[0].EventState)
+
+}
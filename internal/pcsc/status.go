@@ -0,0 +1,186 @@
+package pcsc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// StateUnaware requests the current state of a reader
+	StateUnaware StateFlag = 0x0000
+
+	// StateIgnore ignores a reader
+	StateIgnore StateFlag = 0x0001
+
+	// StateChanged indicates a difference between current and event state
+	StateChanged StateFlag = 0x0002
+
+	// StateUnknown indicates an unknown reader
+	StateUnknown StateFlag = 0x0004
+
+	// StateEmpty indicates a reader without a card
+	StateEmpty StateFlag = 0x0010
+
+	// StatePresent indicates a card in the reader
+	StatePresent StateFlag = 0x0020
+
+	// StateExclusive indicates a card used exclusively by another application
+	StateExclusive StateFlag = 0x0080
+
+	// StateInUse indicates a card shared with other applications
+	StateInUse StateFlag = 0x0100
+)
+
+const (
+	maxReaders    = 16
+	maxATR        = 33
+	pollInterval  = 250 * time.Millisecond
+	readerAbsent  = 0x0002
+	readerPresent = 0x0004
+)
+
+// StateFlag denotes the state of a reader
+type StateFlag uint32
+
+// ReaderState is used to query or wait for the state of a reader
+type ReaderState struct {
+	Reader       string
+	CurrentState StateFlag
+	EventState   StateFlag
+	Atr          []byte
+}
+
+// readerState mirrors pcscd's READER_STATE, as shared with clients
+type readerState struct {
+	Name         [maxReaderName]byte
+	EventCounter uint32
+	State        uint32
+	Sharing      int32
+	ATR          [maxATR]byte
+	_            [3]byte
+	ATRLength    uint32
+	Protocol     uint32
+}
+
+// name returns the reader name
+func (r *readerState) name() string {
+
+	if idx := bytes.IndexByte(r.Name[:], 0); idx >= 0 {
+		return string(r.Name[:idx])
+	}
+
+	return string(r.Name[:])
+
+}
+
+// flags translates the reader state into state flags, including the event
+// counter in the upper 16 bits like libpcsclite does
+func (r *readerState) flags() StateFlag {
+
+	var flags StateFlag
+
+	switch {
+	case r.State&readerPresent != 0:
+		flags |= StatePresent
+	case r.State&readerAbsent != 0:
+		flags |= StateEmpty
+	}
+
+	switch {
+	case r.Sharing < 0:
+		flags |= StateExclusive
+	case r.Sharing > 0:
+		flags |= StateInUse
+	}
+
+	return flags | StateFlag(r.EventCounter&0xffff)<<16
+
+}
+
+// GetStatusChange blocks until the state of one of the readers differs from
+// its current state or the timeout expires (a negative timeout waits forever).
+// Unlike libpcsclite, changes are detected by polling the reader states.
+func (c *Context) GetStatusChange(states []ReaderState, timeout time.Duration) error {
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+
+		current, err := c.readersState()
+
+		if err != nil {
+			return err
+		}
+
+		changed := false
+
+		for idx := range states {
+
+			rs := &states[idx]
+
+			if rs.CurrentState&StateIgnore != 0 {
+				continue
+			}
+
+			event := StateUnknown
+
+			for _, state := range current {
+
+				if state.name() == rs.Reader {
+					event = state.flags()
+					rs.Atr = append([]byte(nil), state.ATR[:state.ATRLength]...)
+					break
+				}
+
+			}
+
+			if event != rs.CurrentState&^StateChanged {
+				event |= StateChanged
+				changed = true
+			}
+
+			rs.EventState = event
+
+		}
+
+		if changed {
+			return nil
+		}
+
+		if timeout >= 0 && time.Now().After(deadline) {
+			return ErrTimeout
+		}
+
+		time.Sleep(pollInterval)
+
+	}
+
+}
+
+// readersState fetches the state of all reader slots
+func (c *Context) readersState() ([]readerState, error) {
+
+	var states [maxReaders]readerState
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := struct {
+		Size    uint32
+		Command uint32
+	}{
+		Command: cmdGetReadersState,
+	}
+
+	if err := binary.Write(c.conn, binary.NativeEndian, header); err != nil {
+		return nil, err
+	}
+
+	if err := c.read(&states); err != nil {
+		return nil, err
+	}
+
+	return states[:], nil
+
+}
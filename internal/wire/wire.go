@@ -0,0 +1,96 @@
+// Package wire implements the length-prefixed frames and the relaying of
+// chained responses shared by the agent and the remote package
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxFrame is the maximum length of a frame
+const MaxFrame = 0xffff
+
+const errFrameTooLarge = "frame too large (%d > %d)"
+
+// sendRemaining fetches the next part of a chained response
+var sendRemaining = []byte{0x00, 0xa5, 0x00, 0x00}
+
+// Transmitter exchanges raw APDUs, e.g. an *ykoath.OATH session
+type Transmitter interface {
+	Transmit([]byte) ([]byte, error)
+}
+
+// ReadFrame reads a length-prefixed frame
+func ReadFrame(r io.Reader) ([]byte, error) {
+
+	var length uint16
+
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, length)
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+
+}
+
+// WriteFrame writes a length-prefixed frame, concatenating all parts
+func WriteFrame(w io.Writer, parts ...[]byte) error {
+
+	var (
+		buf    bytes.Buffer
+		length int
+	)
+
+	for _, part := range parts {
+		length += len(part)
+	}
+
+	if length > MaxFrame {
+		return fmt.Errorf(errFrameTooLarge, length, MaxFrame)
+	}
+
+	_ = binary.Write(&buf, binary.BigEndian, uint16(length))
+
+	for _, part := range parts {
+		buf.Write(part)
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+
+}
+
+// Transmit sends an APDU and fetches all parts of a chained response, so the
+// caller can hold its lock for the whole exchange without depending on the
+// peer to send SEND REMAINING
+func Transmit(t Transmitter, apdu []byte) ([]byte, error) {
+
+	var results []byte
+
+	for {
+
+		res, err := t.Transmit(apdu)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(res) < 2 || res[len(res)-2] != 0x61 {
+			return append(results, res...), nil
+		}
+
+		results = append(results, res[:len(res)-2]...)
+		apdu = sendRemaining
+
+	}
+
+}
@@ -0,0 +1,115 @@
+package ykoath
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON representation of the types of
+// this package. Fields may be added within a version; renaming or removing a
+// field or changing its meaning increases it.
+const SchemaVersion = 1
+
+// ErrorInfo is the JSON representation of an error, including the status
+// word if the device responded with an error status
+type ErrorInfo struct {
+	Message    string `json:"message"`
+	Status     string `json:"status,omitempty"`
+	StatusWord string `json:"status_word,omitempty"`
+}
+
+// NewErrorInfo returns the JSON representation of an error
+func NewErrorInfo(err error) *ErrorInfo {
+
+	info := &ErrorInfo{
+		Message: err.Error(),
+	}
+
+	if sw, ok := StatusWord(err); ok {
+		info.Status = code{byte(sw >> 8), byte(sw)}.Error()
+		info.StatusWord = fmt.Sprintf("%04x", sw)
+	}
+
+	return info
+
+}
+
+// MarshalJSON returns the JSON representation of a credential
+func (c Credential) MarshalJSON() ([]byte, error) {
+
+	v := struct {
+		Account   string `json:"account"`
+		Algorithm string `json:"algorithm"`
+		Issuer    string `json:"issuer,omitempty"`
+		Name      string `json:"name"`
+		Period    int    `json:"period,omitempty"`
+		Type      string `json:"type"`
+	}{
+		Account:   c.Account,
+		Algorithm: c.Algorithm.String(),
+		Issuer:    c.Issuer,
+		Name:      c.Name,
+		Type:      c.Type.String(),
+	}
+
+	// HOTP credentials have no period
+	if c.Type == Totp {
+		v.Period = c.Period
+	}
+
+	return json.Marshal(v)
+
+}
+
+// MarshalJSON returns the JSON representation of a name, which is the one of
+// the credential it describes
+func (n *Name) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.Credential())
+}
+
+// MarshalJSON returns the JSON representation of a code; the value is omitted
+// for codes that require touch and HOTP codes that have not been calculated,
+// the period and window for HOTP codes
+func (c *Code) MarshalJSON() ([]byte, error) {
+
+	v := struct {
+		Name      string `json:"name"`
+		Period    int    `json:"period,omitempty"`
+		Touch     bool   `json:"touch"`
+		Type      string `json:"type"`
+		ValidFrom string `json:"valid_from,omitempty"`
+		ValidTo   string `json:"valid_to,omitempty"`
+		Value     string `json:"value,omitempty"`
+	}{
+		Name:  c.Name,
+		Touch: c.Touch,
+		Type:  c.Type.String(),
+		Value: c.Value,
+	}
+
+	if c.Type != Hotp {
+		v.Period = c.Period
+		v.ValidFrom = c.ValidFrom.UTC().Format(time.RFC3339)
+		v.ValidTo = c.ValidTo.UTC().Format(time.RFC3339)
+	}
+
+	return json.Marshal(v)
+
+}
+
+// MarshalJSON returns the JSON representation of the device information
+// returned by "SELECT"
+func (s *Select) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(struct {
+		ID      string `json:"id,omitempty"`
+		Locked  bool   `json:"locked"`
+		Version string `json:"version"`
+	}{
+		ID:      fmt.Sprintf("%x", s.Name),
+		Locked:  s.IsLocked(),
+		Version: s.VersionString(),
+	})
+
+}
@@ -0,0 +1,105 @@
+package ykoath
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// minKeyLength is the minimum key length accepted by the device; shorter keys
+// are padded with zeros (which does not change the HMAC)
+const minKeyLength = 14
+
+const (
+	errInvalidDigits   = "invalid number of digits (%v not in 6..8)"
+	errInvalidSecret   = "invalid secret"
+	errMissingSecret   = "missing secret"
+	errUnsupportedAlg  = "unsupported algorithm (%v)"
+	errUnsupportedType = "unsupported type (%v)"
+)
+
+// DecodeBase32 decodes a base32 secret as found in otpauth URIs, ignoring case,
+// whitespace and missing padding
+func DecodeBase32(secret string) ([]byte, error) {
+
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	secret = strings.TrimRight(secret, "=")
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidSecret)
+	}
+
+	return key, nil
+
+}
+
+// DecodeHex decodes a hex secret, ignoring case, whitespace, colons and a
+// "0x" prefix
+func DecodeHex(secret string) ([]byte, error) {
+
+	secret = strings.Join(strings.Fields(secret), "")
+	secret = strings.ReplaceAll(secret, ":", "")
+	secret = strings.TrimPrefix(strings.ToLower(secret), "0x")
+
+	key, err := hex.DecodeString(secret)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidSecret)
+	}
+
+	return key, nil
+
+}
+
+// prepareKey prepares a key for the device like other implementations treat
+// it: keys longer than the block size of the hash function are hashed (as the
+// HMAC would do) and keys shorter than the minimum length are padded
+func prepareKey(a Algorithm, key []byte) ([]byte, error) {
+
+	h := a.Hash()
+
+	if h == nil {
+		return nil, fmt.Errorf(errUnsupportedAlg, a)
+	}
+
+	if len(key) == 0 {
+		return nil, errors.New(errMissingSecret)
+	}
+
+	if hash := h(); len(key) > hash.BlockSize() {
+		hash.Write(key)
+		key = hash.Sum(nil)
+	}
+
+	if len(key) < minKeyLength {
+		key = append(append([]byte(nil), key...), make([]byte, minKeyLength-len(key))...)
+	}
+
+	return key, nil
+
+}
+
+// validate checks if the device supports an algorithm, type and number of
+// digits
+func validate(a Algorithm, t Type, digits uint8) error {
+
+	if a.Hash() == nil {
+		return fmt.Errorf(errUnsupportedAlg, a)
+	}
+
+	if t != Hotp && t != Totp {
+		return fmt.Errorf(errUnsupportedType, t)
+	}
+
+	if digits < 6 || digits > 8 {
+		return fmt.Errorf(errInvalidDigits, digits)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,120 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+)
+
+const (
+	errFailedStep         = "failed to %s"
+	errMissingVariable    = "environment variable %s is not set"
+	errRenameNotSupported = "authenticator does not support renaming"
+	errUnknownReference   = "unknown secret reference (use base32:, hex:, env: or file:)"
+	errUnknownSecret      = "unknown secret reference for %s (use base32:, hex:, env: or file:)"
+)
+
+// resolvers resolve the secret references by scheme
+var resolvers = map[string]func(string) ([]byte, error){
+	"base32": ykoath.DecodeBase32,
+	"env": func(name string) ([]byte, error) {
+
+		value, ok := os.LookupEnv(name)
+
+		if !ok {
+			return nil, fmt.Errorf(errMissingVariable, name)
+		}
+
+		return ykoath.DecodeBase32(value)
+
+	},
+	"file": func(path string) ([]byte, error) {
+
+		buf, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return ykoath.DecodeBase32(strings.TrimSpace(string(buf)))
+
+	},
+	"hex": ykoath.DecodeHex,
+}
+
+// ResolveSecret resolves a secret reference: "base32:" and "hex:" followed by
+// the encoded secret, "env:" followed by the name of an environment variable
+// or "file:" followed by the path of a file holding the base32 encoded secret
+func ResolveSecret(ref string) ([]byte, error) {
+
+	scheme, value, _ := strings.Cut(ref, ":")
+	resolve, ok := resolvers[scheme]
+
+	if !ok {
+		return nil, errors.New(errUnknownReference)
+	}
+
+	return resolve(value)
+
+}
+
+// Apply executes the steps of a plan in order, stopping at the first failure.
+// Planning again after a failure continues where Apply stopped.
+func Apply(a ykoath.Authenticator, steps []*Step) error {
+
+	for _, step := range steps {
+
+		if err := apply(a, step); err != nil {
+			return errors.Wrapf(err, errFailedStep, step)
+		}
+
+	}
+
+	return nil
+
+}
+
+// apply executes one step
+func apply(a ykoath.Authenticator, step *Step) error {
+
+	switch step.Action {
+	case Delete:
+		return a.Delete(step.Name)
+	case Rename:
+
+		r, ok := a.(renamer)
+
+		if !ok {
+			return errors.New(errRenameNotSupported)
+		}
+
+		return r.Rename(step.Name, step.To)
+
+	}
+
+	c := step.Credential
+
+	algorithm, err := c.algorithm()
+
+	if err != nil {
+		return err
+	}
+
+	kind, err := c.kind()
+
+	if err != nil {
+		return err
+	}
+
+	secret, err := ResolveSecret(c.Secret)
+
+	if err != nil {
+		return err
+	}
+
+	return a.Put(c.Name, algorithm, kind, c.digits(), secret, c.Touch)
+
+}
@@ -0,0 +1,194 @@
+// Package manifest provisions keys declaratively: a manifest describes the
+// desired credentials, Plan compares it with the credentials held by an
+// ykoath.Authenticator and Apply executes the resulting steps. Applying the
+// same manifest twice changes nothing.
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the version of the manifest format
+const Version = 1
+
+const (
+	errDuplicateName      = "duplicate name %q"
+	errInvalidDigits      = "invalid digits for %s (%d, must be 6 to 8)"
+	errInvalidManifest    = "invalid manifest"
+	errMissingName        = "credential without name"
+	errMissingSecret      = "missing secret for %s"
+	errNameTooLong        = "name too long (%d > 64)"
+	errUnknownAlgorithm   = "unknown algorithm for %s (%s)"
+	errUnknownType        = "unknown type for %s (%s)"
+	errUnsupportedVersion = "unsupported manifest version (%d)"
+)
+
+// Manifest describes the desired credentials of a key. With Prune, Plan also
+// deletes credentials that are not part of the manifest.
+//
+//	version: 1
+//	prune: true
+//	credentials:
+//	  - name: GitHub:me
+//	    secret: env:GITHUB_SECRET
+//	    touch: true
+//	  - name: 60/VPN:me
+//	    algorithm: SHA256
+//	    digits: 8
+//	    renamed_from: [VPN:me]
+//	    secret: file:/run/secrets/vpn
+type Manifest struct {
+	Credentials []*Credential `json:"credentials" yaml:"credentials"`
+	Prune       bool          `json:"prune,omitempty" yaml:"prune,omitempty"`
+	Version     int           `json:"version" yaml:"version"`
+}
+
+// Credential is a desired credential. Algorithm (SHA1, SHA256 or SHA512),
+// Type (TOTP or HOTP) and Digits default to SHA1, TOTP and 6. Secret
+// references the key (see ResolveSecret) and is only resolved when the
+// credential is written. RenamedFrom lists previous names of the credential,
+// which are renamed instead of creating the credential anew.
+type Credential struct {
+	Algorithm   string   `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Digits      uint8    `json:"digits,omitempty" yaml:"digits,omitempty"`
+	Name        string   `json:"name" yaml:"name"`
+	RenamedFrom []string `json:"renamed_from,omitempty" yaml:"renamed_from,omitempty"`
+	Secret      string   `json:"secret" yaml:"secret"`
+	Touch       bool     `json:"touch,omitempty" yaml:"touch,omitempty"`
+	Type        string   `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// Parse parses and validates a YAML or JSON manifest
+func Parse(buf []byte) (*Manifest, error) {
+
+	var m Manifest
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.Wrapf(err, errInvalidManifest)
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+
+}
+
+// Validate checks the version of the manifest and its credentials
+func (m *Manifest) Validate() error {
+
+	if m.Version != Version {
+		return fmt.Errorf(errUnsupportedVersion, m.Version)
+	}
+
+	names := make(map[string]bool)
+
+	for _, c := range m.Credentials {
+
+		if err := c.Validate(); err != nil {
+			return err
+		}
+
+		for _, name := range append([]string{c.Name}, c.RenamedFrom...) {
+
+			if names[name] {
+				return fmt.Errorf(errDuplicateName, name)
+			}
+
+			names[name] = true
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// Validate checks a credential without resolving its secret
+func (c *Credential) Validate() error {
+
+	if c.Name == "" {
+		return errors.New(errMissingName)
+	}
+
+	if l := len(c.Name); l > 64 {
+		return fmt.Errorf(errNameTooLong, l)
+	}
+
+	if _, err := c.algorithm(); err != nil {
+		return err
+	}
+
+	if _, err := c.kind(); err != nil {
+		return err
+	}
+
+	if d := c.digits(); d < 6 || d > 8 {
+		return fmt.Errorf(errInvalidDigits, c.Name, d)
+	}
+
+	if c.Secret == "" {
+		return fmt.Errorf(errMissingSecret, c.Name)
+	}
+
+	scheme, _, _ := strings.Cut(c.Secret, ":")
+
+	if _, ok := resolvers[scheme]; !ok {
+		return fmt.Errorf(errUnknownSecret, c.Name)
+	}
+
+	return nil
+
+}
+
+// algorithm returns the algorithm of a credential
+func (c *Credential) algorithm() (ykoath.Algorithm, error) {
+
+	switch strings.TrimPrefix(strings.ToUpper(c.Algorithm), "HMAC-") {
+	case "", "SHA1":
+		return ykoath.HmacSha1, nil
+	case "SHA256":
+		return ykoath.HmacSha256, nil
+	case "SHA512":
+		return ykoath.HmacSha512, nil
+	}
+
+	return 0, fmt.Errorf(errUnknownAlgorithm, c.Name, c.Algorithm)
+
+}
+
+// kind returns the type of a credential
+func (c *Credential) kind() (ykoath.Type, error) {
+
+	switch strings.ToUpper(c.Type) {
+	case "", "TOTP":
+		return ykoath.Totp, nil
+	case "HOTP":
+		return ykoath.Hotp, nil
+	}
+
+	return 0, fmt.Errorf(errUnknownType, c.Name, c.Type)
+
+}
+
+// digits returns the digits of a credential
+func (c *Credential) digits() uint8 {
+
+	if c.Digits == 0 {
+		return 6
+	}
+
+	return c.Digits
+
+}
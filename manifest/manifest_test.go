@@ -0,0 +1,263 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+)
+
+// testCredential is a credential held by a testAuthenticator
+type testCredential struct {
+	algorithm ykoath.Algorithm
+	digits    uint8
+	key       []byte
+	touch     bool
+	kind      ykoath.Type
+}
+
+// testAuthenticator holds credentials in memory, reporting their digits and
+// touch requirements like a key does
+type testAuthenticator struct {
+	ykoath.Authenticator
+	credentials map[string]*testCredential
+	writes      int
+}
+
+func newTestAuthenticator() *testAuthenticator {
+
+	return &testAuthenticator{
+		credentials: make(map[string]*testCredential),
+	}
+
+}
+
+func (t *testAuthenticator) CalculateAllAt(now time.Time) ([]*ykoath.Code, error) {
+
+	var codes []*ykoath.Code
+
+	for name, c := range t.credentials {
+
+		code := &ykoath.Code{
+			Name:  name,
+			Touch: c.touch,
+			Type:  c.kind,
+		}
+
+		if !c.touch && c.kind == ykoath.Totp {
+			code.Value = strings.Repeat("1", int(c.digits))
+		}
+
+		codes = append(codes, code)
+
+	}
+
+	return codes, nil
+
+}
+
+func (t *testAuthenticator) Delete(name string) error {
+
+	t.writes++
+	delete(t.credentials, name)
+
+	return nil
+
+}
+
+func (t *testAuthenticator) List() ([]*ykoath.Name, error) {
+
+	var names []*ykoath.Name
+
+	for name, c := range t.credentials {
+
+		names = append(names, &ykoath.Name{
+			Algorithm: c.algorithm,
+			Name:      name,
+			Type:      c.kind,
+		})
+
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].Name < names[j].Name
+	})
+
+	return names, nil
+
+}
+
+func (t *testAuthenticator) Put(name string, a ykoath.Algorithm, kind ykoath.Type, digits uint8, key []byte, touch bool) error {
+
+	t.writes++
+	t.credentials[name] = &testCredential{a, digits, key, touch, kind}
+
+	return nil
+
+}
+
+func (t *testAuthenticator) Rename(from, to string) error {
+
+	t.writes++
+	t.credentials[to] = t.credentials[from]
+	delete(t.credentials, from)
+
+	return nil
+
+}
+
+const testManifest = `
+version: 1
+prune: true
+credentials:
+  - name: GitHub:me
+    secret: base32:JBSWY3DPEHPK3PXP
+    touch: true
+  - name: 60/VPN:me
+    algorithm: SHA256
+    digits: 8
+    renamed_from: [VPN:me]
+    secret: env:YKOATH_TEST_VPN
+  - name: counter
+    type: HOTP
+    secret: hex:3132333435363738393031323334353637383930
+`
+
+func TestParse(t *testing.T) {
+
+	assert := assert.New(t)
+
+	m, err := Parse([]byte(testManifest))
+	require.NoError(t, err)
+
+	assert.True(m.Prune)
+	assert.Len(m.Credentials, 3)
+	assert.Equal([]string{"VPN:me"}, m.Credentials[1].RenamedFrom)
+
+	m, err = Parse([]byte(`{"version": 1, "credentials": [{"name": "GitHub:me", "secret": "base32:JBSWY3DPEHPK3PXP"}]}`))
+	require.NoError(t, err)
+	assert.Equal("GitHub:me", m.Credentials[0].Name)
+
+	for _, manifest := range []string{
+		`credentials: []`,
+		`{"version": 2}`,
+		`{"version": 1, "unknown": true}`,
+		`{"version": 1, "credentials": [{"secret": "base32:JBSWY3DPEHPK3PXP"}]}`,
+		`{"version": 1, "credentials": [{"name": "me"}]}`,
+		`{"version": 1, "credentials": [{"name": "me", "secret": "JBSWY3DPEHPK3PXP"}]}`,
+		`{"version": 1, "credentials": [{"name": "me", "secret": "base32:JBSWY3DPEHPK3PXP", "algorithm": "MD5"}]}`,
+		`{"version": 1, "credentials": [{"name": "me", "secret": "base32:JBSWY3DPEHPK3PXP", "type": "steam"}]}`,
+		`{"version": 1, "credentials": [{"name": "me", "secret": "base32:JBSWY3DPEHPK3PXP", "digits": 10}]}`,
+		`{"version": 1, "credentials": [{"name": "me", "secret": "base32:A"}, {"name": "you", "renamed_from": ["me"], "secret": "base32:A"}]}`,
+	} {
+
+		_, err := Parse([]byte(manifest))
+		assert.Error(err, manifest)
+
+	}
+
+}
+
+func TestPlanAndApply(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		a       = newTestAuthenticator()
+	)
+
+	t.Setenv("YKOATH_TEST_VPN", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+
+	a.credentials["GitHub:me"] = &testCredential{ykoath.HmacSha1, 6, nil, false, ykoath.Totp}
+	a.credentials["VPN:me"] = &testCredential{ykoath.HmacSha256, 8, []byte("old"), false, ykoath.Totp}
+	a.credentials["stale"] = &testCredential{ykoath.HmacSha1, 6, nil, false, ykoath.Totp}
+
+	m, err := Parse([]byte(testManifest))
+	require.NoError(err)
+
+	steps, err := m.Plan(a)
+	require.NoError(err)
+
+	var descriptions []string
+
+	for _, step := range steps {
+		descriptions = append(descriptions, step.String())
+	}
+
+	assert.Equal([]string{
+		"rename VPN:me to 60/VPN:me",
+		"delete stale",
+		"update GitHub:me (touch false -> true)",
+		"create counter",
+	}, descriptions)
+
+	require.NoError(Apply(a, steps))
+
+	assert.Equal([]byte("old"), a.credentials["60/VPN:me"].key)
+	assert.Equal([]byte("12345678901234567890"), a.credentials["counter"].key)
+	assert.Equal(ykoath.Hotp, a.credentials["counter"].kind)
+	assert.True(a.credentials["GitHub:me"].touch)
+	assert.NotContains(a.credentials, "stale")
+
+	writes := a.writes
+
+	steps, err = m.Plan(a)
+	require.NoError(err)
+	assert.Empty(steps)
+
+	require.NoError(Apply(a, steps))
+	assert.Equal(writes, a.writes)
+
+	m.Credentials[1].Digits = 6
+	m.Credentials[1].Algorithm = "SHA1"
+
+	steps, err = m.Plan(a)
+	require.NoError(err)
+	require.Len(steps, 1)
+	assert.Equal("update 60/VPN:me (algorithm HMAC-SHA256 -> HMAC-SHA1, digits 8 -> 6)", steps[0].String())
+
+	require.NoError(Apply(a, steps))
+	assert.Equal([]byte("12345678901234567890"), a.credentials["60/VPN:me"].key)
+
+	m.Credentials[0].Secret = "env:YKOATH_TEST_MISSING"
+	m.Credentials[0].Touch = false
+
+	steps, err = m.Plan(a)
+	require.NoError(err)
+	assert.ErrorContains(Apply(a, steps), "failed to update GitHub:me")
+
+}
+
+func TestResolveSecret(t *testing.T) {
+
+	var (
+		assert = assert.New(t)
+		path   = filepath.Join(t.TempDir(), "secret")
+	)
+
+	require.NoError(t, os.WriteFile(path, []byte("GEZDGNBVGY3TQOJQ\n"), 0600))
+	t.Setenv("YKOATH_TEST_SECRET", "gezdgnbvgy3tqojq")
+
+	for _, ref := range []string{"base32:GEZDGNBVGY3TQOJQ", "hex:31323334353637383930", "env:YKOATH_TEST_SECRET", "file:" + path} {
+
+		secret, err := ResolveSecret(ref)
+
+		assert.NoError(err, ref)
+		assert.Equal([]byte("1234567890"), secret, ref)
+
+	}
+
+	for _, ref := range []string{"GEZDGNBVGY3TQOJQ", "env:YKOATH_TEST_MISSING", "file:" + path + ".missing"} {
+
+		_, err := ResolveSecret(ref)
+		assert.Error(err, ref)
+
+	}
+
+}
@@ -0,0 +1,261 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yawn/ykoath"
+)
+
+const (
+	// Create writes a credential that does not exist yet
+	Create Action = "create"
+
+	// Delete removes a credential that is not part of the manifest
+	Delete Action = "delete"
+
+	// Rename renames a credential listed in RenamedFrom
+	Rename Action = "rename"
+
+	// Update overwrites a credential with different parameters
+	Update Action = "update"
+)
+
+// Action is the kind of change of a step
+type Action string
+
+// Step changes one credential. Name is the current name of the credential
+// (the new name when creating it), To the new name when renaming it and
+// Credential the desired credential (nil when deleting).
+type Step struct {
+	Action     Action      `json:"action"`
+	Credential *Credential `json:"-"`
+	Name       string      `json:"name"`
+	Reason     string      `json:"reason,omitempty"`
+	To         string      `json:"to,omitempty"`
+}
+
+// calculator is implemented by authenticators reporting touch requirements
+// and digits
+type calculator interface {
+	CalculateAllAt(t time.Time) ([]*ykoath.Code, error)
+}
+
+// renamer is implemented by authenticators that can rename credentials
+type renamer interface {
+	Rename(from, to string) error
+}
+
+// current is a credential held by an authenticator, with the digits and the
+// touch requirement if known
+type current struct {
+	digits uint8
+	name   *ykoath.Name
+	touch  *bool
+}
+
+// String describes a step
+func (s *Step) String() string {
+
+	switch s.Action {
+	case Rename:
+		return fmt.Sprintf("rename %s to %s", s.Name, s.To)
+	case Update:
+		return fmt.Sprintf("update %s (%s)", s.Name, s.Reason)
+	}
+
+	return fmt.Sprintf("%s %s", s.Action, s.Name)
+
+}
+
+// Plan returns the steps changing the credentials of an authenticator to the
+// manifest: renames first, then deletions (freeing space) and finally the
+// credentials to create or update. Secrets cannot be read back, so credentials
+// are compared by name, algorithm and type and, if the authenticator reports
+// them (like *ykoath.OATH does), by digits and touch requirement. To replace a
+// secret, rename or delete the credential.
+func (m *Manifest) Plan(a ykoath.Authenticator) ([]*Step, error) {
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	credentials, err := inventory(a)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		deletes []*Step
+		renames []*Step
+		writes  []*Step
+		desired = make(map[string]bool)
+	)
+
+	_, canRename := a.(renamer)
+
+	for _, c := range m.Credentials {
+
+		desired[c.Name] = true
+
+		if credentials[c.Name] != nil || !canRename {
+			continue
+		}
+
+		for _, from := range c.RenamedFrom {
+
+			if existing := credentials[from]; existing != nil {
+
+				renames = append(renames, &Step{
+					Action:     Rename,
+					Credential: c,
+					Name:       from,
+					To:         c.Name,
+				})
+
+				credentials[c.Name] = existing
+				delete(credentials, from)
+
+				break
+
+			}
+
+		}
+
+	}
+
+	if m.Prune {
+
+		for name := range credentials {
+
+			if !desired[name] {
+
+				deletes = append(deletes, &Step{
+					Action: Delete,
+					Name:   name,
+				})
+
+			}
+
+		}
+
+		sort.Slice(deletes, func(i, j int) bool {
+			return deletes[i].Name < deletes[j].Name
+		})
+
+	}
+
+	for _, c := range m.Credentials {
+
+		existing := credentials[c.Name]
+
+		if existing == nil {
+
+			writes = append(writes, &Step{
+				Action:     Create,
+				Credential: c,
+				Name:       c.Name,
+			})
+
+			continue
+
+		}
+
+		if reason := existing.diff(c); reason != "" {
+
+			writes = append(writes, &Step{
+				Action:     Update,
+				Credential: c,
+				Name:       c.Name,
+				Reason:     reason,
+			})
+
+		}
+
+	}
+
+	return append(append(renames, deletes...), writes...), nil
+
+}
+
+// inventory returns the credentials of an authenticator by name
+func inventory(a ykoath.Authenticator) (map[string]*current, error) {
+
+	names, err := a.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make(map[string]*current, len(names))
+
+	for _, name := range names {
+		credentials[name.Name] = &current{name: name}
+	}
+
+	c, ok := a.(calculator)
+
+	if !ok {
+		return credentials, nil
+	}
+
+	// CALCULATE ALL reports touch requirements and the digits of the codes
+	// of TOTP credentials (HOTP credentials are not calculated)
+	codes, err := c.CalculateAllAt(time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+
+		existing := credentials[code.Name]
+
+		if existing == nil || code.Type != ykoath.Totp {
+			continue
+		}
+
+		touch := code.Touch
+		existing.touch = &touch
+
+		if code.Value != "" {
+			existing.digits = uint8(len(code.Value))
+		}
+
+	}
+
+	return credentials, nil
+
+}
+
+// diff describes the differences of an existing to a desired credential
+func (c *current) diff(desired *Credential) string {
+
+	var (
+		algorithm, _ = desired.algorithm()
+		kind, _      = desired.kind()
+		reasons      []string
+	)
+
+	if c.name.Algorithm != algorithm {
+		reasons = append(reasons, fmt.Sprintf("algorithm %s -> %s", c.name.Algorithm, algorithm))
+	}
+
+	if c.name.Type != kind {
+		reasons = append(reasons, fmt.Sprintf("type %s -> %s", c.name.Type, kind))
+	}
+
+	if c.digits != 0 && c.digits != desired.digits() {
+		reasons = append(reasons, fmt.Sprintf("digits %d -> %d", c.digits, desired.digits()))
+	}
+
+	if c.touch != nil && *c.touch != desired.Touch {
+		reasons = append(reasons, fmt.Sprintf("touch %t -> %t", *c.touch, desired.Touch))
+	}
+
+	return strings.Join(reasons, ", ")
+
+}
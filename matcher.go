@@ -0,0 +1,160 @@
+package ykoath
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Matcher selects the names matching a query. Calculate, CalculateSet and
+// Find fail with ErrUnknownName if no name and ErrMultipleMatches if more than
+// one name is selected.
+type Matcher func(query string, names []string) ([]string, error)
+
+// MatchExact selects the name equal to the query
+func MatchExact(query string, names []string) ([]string, error) {
+
+	return filter(names, func(name string) bool {
+		return name == query
+	}), nil
+
+}
+
+// MatchSubstring selects all names containing the query, ignoring case
+func MatchSubstring(query string, names []string) ([]string, error) {
+
+	query = strings.ToLower(query)
+
+	return filter(names, func(name string) bool {
+		return strings.Contains(strings.ToLower(name), query)
+	}), nil
+
+}
+
+// MatchExactThenSubstring selects the name equal to the query or, if there is
+// none, all names containing the query ignoring case. This is the default and
+// the behaviour of ykman
+// (https://github.com/Yubico/yubikey-manager/blob/f493008d78a0ad09016f23dabd1cb658929d9c0e/ykman/cli/oath.py#L543).
+func MatchExactThenSubstring(query string, names []string) ([]string, error) {
+
+	if matches, _ := MatchExact(query, names); len(matches) == 1 {
+		return matches, nil
+	}
+
+	return MatchSubstring(query, names)
+
+}
+
+// MatchPrefix selects all names starting with the query (ignoring a period
+// prefix such as "60/"), ignoring case
+func MatchPrefix(query string, names []string) ([]string, error) {
+
+	query = strings.ToLower(query)
+
+	return filter(names, func(name string) bool {
+		_, rest := splitPeriod(name)
+		return strings.HasPrefix(strings.ToLower(name), query) || strings.HasPrefix(strings.ToLower(rest), query)
+	}), nil
+
+}
+
+// MatchIssuerAccount selects all names with the issuer and account of an
+// "issuer:account" query, ignoring case and the period. A query without issuer
+// selects names without issuer.
+func MatchIssuerAccount(query string, names []string) ([]string, error) {
+
+	issuer, account := splitIssuer(query)
+
+	return filter(names, func(name string) bool {
+		_, rest := splitPeriod(name)
+		i, a := splitIssuer(rest)
+		return strings.EqualFold(i, issuer) && strings.EqualFold(a, account)
+	}), nil
+
+}
+
+// MatchGlob selects all names matching a shell pattern ("*", "?", "[...]" and
+// "[!...]"), ignoring case. Unlike path.Match, "*" also matches "/".
+func MatchGlob(query string, names []string) ([]string, error) {
+
+	var (
+		class   bool
+		expr    strings.Builder
+		first   bool
+		negated bool
+	)
+
+	expr.WriteString("(?i)^")
+
+	for _, r := range query {
+
+		switch {
+		case class && first && !negated && r == '!':
+			negated = true
+			expr.WriteRune('^')
+		case class && first && r == ']':
+			// a leading "]" is a literal, as in the shell
+			first = false
+			expr.WriteString(`\]`)
+		case class:
+			class, first = r != ']', false
+			expr.WriteRune(r)
+		case r == '*':
+			expr.WriteString(".*")
+		case r == '?':
+			expr.WriteString(".")
+		case r == '[':
+			class, first, negated = true, true, false
+			expr.WriteRune(r)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+
+	}
+
+	expr.WriteString("$")
+
+	return MatchRegexp(expr.String(), names)
+
+}
+
+// MatchRegexp selects all names matching a regular expression (see
+// regexp/syntax), which is not anchored and case sensitive unless specified
+func MatchRegexp(query string, names []string) ([]string, error) {
+
+	re, err := regexp.Compile(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filter(names, re.MatchString), nil
+
+}
+
+// match returns the names matching a query, using the configured matcher
+func (o *OATH) match(query string, names []string) ([]string, error) {
+
+	if o.Matcher == nil {
+		return MatchExactThenSubstring(query, names)
+	}
+
+	return o.Matcher(query, names)
+
+}
+
+// filter returns all names satisfying a predicate
+func filter(names []string, predicate func(string) bool) []string {
+
+	var matches []string
+
+	for _, name := range names {
+
+		if predicate(name) {
+			matches = append(matches, name)
+		}
+
+	}
+
+	return matches
+
+}
@@ -0,0 +1,201 @@
+package nativehost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const configVersion = 1
+
+const (
+	errFailedToParse      = "failed to parse config %s"
+	errFailedToRead       = "failed to read config %s"
+	errFailedToWrite      = "failed to write config %s"
+	errInvalidOrigin      = "invalid origin %q"
+	errUnsupportedVersion = "unsupported config version (%d)"
+)
+
+// Config maps web origins (scheme, host and port) to credential names and is
+// stored as JSON file
+type Config struct {
+	mu      sync.Mutex
+	origins map[string]string
+	path    string
+}
+
+// configFile is the format of the config file
+type configFile struct {
+	Origins map[string]string `json:"origins"`
+	Version int               `json:"version"`
+}
+
+// LoadConfig reads the config at a path, returning an empty config if the
+// file does not exist yet
+func LoadConfig(path string) (*Config, error) {
+
+	c := &Config{
+		origins: make(map[string]string),
+		path:    path,
+	}
+
+	buf, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, errFailedToRead, path)
+	}
+
+	var f configFile
+
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, errors.Wrapf(err, errFailedToParse, path)
+	}
+
+	if f.Version != configVersion {
+		return nil, fmt.Errorf(errUnsupportedVersion, f.Version)
+	}
+
+	for origin, name := range f.Origins {
+		c.origins[origin] = name
+	}
+
+	return c, nil
+
+}
+
+// Lookup returns the credential name mapped to the origin of a URL (or an
+// empty string)
+func (c *Config) Lookup(rawURL string) string {
+
+	origin, err := Origin(rawURL)
+
+	if err != nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.origins[origin]
+
+}
+
+// Map maps the origin of a URL to a credential name (or removes the mapping
+// for an empty name) and saves the config, returning the origin
+func (c *Config) Map(rawURL, name string) (string, error) {
+
+	origin, err := Origin(rawURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if name == "" {
+		delete(c.origins, origin)
+	} else {
+		c.origins[origin] = name
+	}
+
+	return origin, c.save()
+
+}
+
+// Mappings returns a copy of all mappings
+func (c *Config) Mappings() map[string]string {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mappings := make(map[string]string, len(c.origins))
+
+	for origin, name := range c.origins {
+		mappings[origin] = name
+	}
+
+	return mappings
+
+}
+
+// save writes the config atomically
+func (c *Config) save() error {
+
+	buf, err := json.MarshalIndent(&configFile{
+		Origins: c.origins,
+		Version: configVersion,
+	}, "", "  ")
+
+	if err != nil {
+		return errors.Wrapf(err, errFailedToWrite, c.path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return errors.Wrapf(err, errFailedToWrite, c.path)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+
+	if err != nil {
+		return errors.Wrapf(err, errFailedToWrite, c.path)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, errFailedToWrite, c.path)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, errFailedToWrite, c.path)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return errors.Wrapf(err, errFailedToWrite, c.path)
+	}
+
+	return nil
+
+}
+
+// Origin returns the origin (lower case scheme and host, and the port if it
+// is not the default one) of a URL
+func Origin(rawURL string) (string, error) {
+
+	u, err := url.Parse(rawURL)
+
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf(errInvalidOrigin, rawURL)
+	}
+
+	var (
+		scheme = strings.ToLower(u.Scheme)
+		host   = strings.ToLower(u.Hostname())
+		port   = u.Port()
+	)
+
+	if scheme == "https" && port == "443" || scheme == "http" && port == "80" {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	if port != "" {
+		host += ":" + port
+	}
+
+	return scheme + "://" + host, nil
+
+}
@@ -0,0 +1,256 @@
+// Package nativehost implements a browser native messaging host
+// (https://developer.chrome.com/docs/extensions/develop/concepts/native-messaging),
+// letting an extension list credentials and fill in codes.
+//
+// Messages are JSON objects prefixed with their length (32 bit, native byte
+// order) on stdin and stdout. Every request carries a type and an optional id
+// that is copied to its responses:
+//
+//	{"id": 1, "type": "list"}
+//	{"id": 2, "type": "calculate", "origin": "https://github.com/login"}
+//	{"id": 3, "type": "calculate", "origin": "https://github.com/login", "name": "GitHub:me"}
+//	{"id": 4, "type": "map", "origin": "https://github.com", "name": "GitHub:me"}
+//	{"id": 5, "type": "unmap", "origin": "https://github.com"}
+//	{"id": 6, "type": "mappings"}
+//
+// Codes are only calculated for the credential mapped to the origin of a
+// request; a name given with the origin must match the mapping. Calculating a
+// credential that requires touch sends a "touch" notification before the
+// "code" response. Failures are answered with an "error" response.
+package nativehost
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+)
+
+const (
+
+	// maxRequest is the size limit of messages sent by the browser
+	maxRequest = 64 << 20
+
+	// maxResponse is the size limit of messages sent to the browser
+	maxResponse = 1 << 20
+)
+
+const (
+	errMessageTooLarge = "message too large (%d > %d)"
+	errMissingName     = "missing name"
+	errMissingOrigin   = "missing origin"
+	errNameNotMapped   = "%s is not mapped to %s"
+	errOriginNotMapped = "no credential mapped to %s"
+	errUnknownType     = "unknown request type (%s)"
+)
+
+// Request is a message sent by the browser
+type Request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Origin string          `json:"origin,omitempty"`
+	Type   string          `json:"type"`
+}
+
+// Response is a message sent to the browser
+type Response struct {
+	ID          json.RawMessage     `json:"id,omitempty"`
+	Schema      int                 `json:"schema"`
+	Type        string              `json:"type"`
+	Code        string              `json:"code,omitempty"`
+	Credentials []ykoath.Credential `json:"credentials,omitempty"`
+	Error       *ykoath.ErrorInfo   `json:"error,omitempty"`
+	Mappings    map[string]string   `json:"mappings,omitempty"`
+	Name        string              `json:"name,omitempty"`
+	Origin      string              `json:"origin,omitempty"`
+}
+
+// Host answers the requests of a browser extension with the credentials of an
+// authenticator
+type Host struct {
+	Authenticator ykoath.Authenticator
+	Config        *Config
+	mu            sync.Mutex
+	w             io.Writer
+}
+
+// New creates a host for an authenticator and an origin mapping
+func New(a ykoath.Authenticator, config *Config) *Host {
+
+	return &Host{
+		Authenticator: a,
+		Config:        config,
+	}
+
+}
+
+// Serve answers requests read from r (usually stdin) on w (usually stdout)
+// until r is closed
+func (h *Host) Serve(r io.Reader, w io.Writer) error {
+
+	h.w = w
+
+	for {
+
+		var req Request
+
+		if err := ReadMessage(r, &req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		res, err := h.handle(&req)
+
+		if err != nil {
+			res = &Response{
+				Error: ykoath.NewErrorInfo(err),
+				Type:  "error",
+			}
+		}
+
+		if err := h.send(&req, res); err != nil {
+			return err
+		}
+
+	}
+
+}
+
+// handle answers a single request
+func (h *Host) handle(req *Request) (*Response, error) {
+
+	switch req.Type {
+
+	case "list":
+
+		names, err := h.Authenticator.List()
+
+		if err != nil {
+			return nil, err
+		}
+
+		res := &Response{
+			Credentials: make([]ykoath.Credential, len(names)),
+			Type:        "credentials",
+		}
+
+		for idx, name := range names {
+			res.Credentials[idx] = name.Credential()
+		}
+
+		return res, nil
+
+	case "calculate":
+
+		if req.Origin == "" {
+			return nil, errors.New(errMissingOrigin)
+		}
+
+		name := h.Config.Lookup(req.Origin)
+
+		if name == "" {
+			return nil, fmt.Errorf(errOriginNotMapped, req.Origin)
+		}
+
+		if req.Name != "" && req.Name != name {
+			return nil, fmt.Errorf(errNameNotMapped, req.Name, req.Origin)
+		}
+
+		code, err := h.Authenticator.Calculate(name, func(name string) error {
+			return h.send(req, &Response{Name: name, Type: "touch"})
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Response{Code: code, Name: name, Type: "code"}, nil
+
+	case "map", "unmap":
+
+		if req.Origin == "" {
+			return nil, errors.New(errMissingOrigin)
+		}
+
+		if req.Type == "map" && req.Name == "" {
+			return nil, errors.New(errMissingName)
+		}
+
+		origin, err := h.Config.Map(req.Origin, req.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Response{Name: req.Name, Origin: origin, Type: req.Type}, nil
+
+	case "mappings":
+		return &Response{Mappings: h.Config.Mappings(), Type: "mappings"}, nil
+
+	}
+
+	return nil, fmt.Errorf(errUnknownType, req.Type)
+
+}
+
+// send writes a response to a request
+func (h *Host) send(req *Request, res *Response) error {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	res.ID = req.ID
+	res.Schema = ykoath.SchemaVersion
+
+	return WriteMessage(h.w, res)
+
+}
+
+// ReadMessage reads a length-prefixed JSON message
+func ReadMessage(r io.Reader, v interface{}) error {
+
+	var length uint32
+
+	if err := binary.Read(r, binary.NativeEndian, &length); err != nil {
+		return err
+	}
+
+	if length > maxRequest {
+		return fmt.Errorf(errMessageTooLarge, length, maxRequest)
+	}
+
+	buf := make([]byte, length)
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+
+}
+
+// WriteMessage writes a length-prefixed JSON message
+func WriteMessage(w io.Writer, v interface{}) error {
+
+	buf, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	if len(buf) > maxResponse {
+		return fmt.Errorf(errMessageTooLarge, len(buf), maxResponse)
+	}
+
+	msg := binary.NativeEndian.AppendUint32(nil, uint32(len(buf)))
+
+	_, err = w.Write(append(msg, buf...))
+
+	return err
+
+}
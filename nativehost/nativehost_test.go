@@ -0,0 +1,170 @@
+package nativehost
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+)
+
+// testAuthenticator holds a credential that requires touch and one that does
+// not
+type testAuthenticator struct {
+	ykoath.Authenticator
+}
+
+func (t *testAuthenticator) List() ([]*ykoath.Name, error) {
+
+	return []*ykoath.Name{
+		{Algorithm: ykoath.HmacSha1, Name: "GitHub:me", Type: ykoath.Totp},
+		{Algorithm: ykoath.HmacSha256, Name: "touchy", Type: ykoath.Totp},
+	}, nil
+
+}
+
+func (t *testAuthenticator) Calculate(name string, touchRequiredCallback func(string) error) (string, error) {
+
+	switch name {
+	case "GitHub:me":
+		return "123456", nil
+	case "touchy":
+
+		if err := touchRequiredCallback(name); err != nil {
+			return "", err
+		}
+
+		return "654321", nil
+
+	}
+
+	return "", ykoath.ErrUnknownName
+
+}
+
+// exchange sends requests to a host and returns all responses
+func exchange(t *testing.T, h *Host, requests ...string) []map[string]interface{} {
+
+	var in, out bytes.Buffer
+
+	for _, req := range requests {
+		require.NoError(t, WriteMessage(&in, json.RawMessage(req)))
+	}
+
+	require.NoError(t, h.Serve(&in, &out))
+
+	var responses []map[string]interface{}
+
+	for {
+
+		var res map[string]interface{}
+
+		err := ReadMessage(&out, &res)
+
+		if err == io.EOF {
+			return responses
+		}
+
+		require.NoError(t, err)
+
+		responses = append(responses, res)
+
+	}
+
+}
+
+func TestHost(t *testing.T) {
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		path    = filepath.Join(t.TempDir(), "ykoath", "origins.json")
+	)
+
+	config, err := LoadConfig(path)
+	require.NoError(err)
+
+	responses := exchange(t, New(&testAuthenticator{}, config),
+		`{"id": 1, "type": "list"}`,
+		`{"id": 2, "type": "calculate", "origin": "https://github.com/login"}`,
+		`{"id": 3, "type": "map", "origin": "https://GitHub.com:443/login", "name": "GitHub:me"}`,
+		`{"id": 4, "type": "calculate", "origin": "https://github.com/session"}`,
+		`{"id": 5, "type": "map", "origin": "https://example.com", "name": "touchy"}`,
+		`{"id": "6", "type": "calculate", "origin": "https://example.com/login", "name": "touchy"}`,
+		`{"id": 7, "type": "calculate", "name": "GitHub:me"}`,
+		`{"id": 8, "type": "calculate", "origin": "https://example.com/login", "name": "GitHub:me"}`,
+		`{"id": 9, "type": "mappings"}`,
+		`{"type": "unknown"}`,
+	)
+
+	require.Len(responses, 11)
+
+	assert.Equal("credentials", responses[0]["type"])
+	assert.Len(responses[0]["credentials"], 2)
+	assert.EqualValues(ykoath.SchemaVersion, responses[0]["schema"])
+
+	assert.Equal("error", responses[1]["type"])
+	assert.EqualValues(2, responses[1]["id"])
+
+	assert.Equal("https://github.com", responses[2]["origin"])
+
+	assert.Equal("code", responses[3]["type"])
+	assert.Equal("123456", responses[3]["code"])
+	assert.Equal("GitHub:me", responses[3]["name"])
+
+	assert.Equal(map[string]interface{}{"id": "6", "name": "touchy", "schema": 1.0, "type": "touch"}, responses[5])
+	assert.Equal("654321", responses[6]["code"])
+	assert.Equal("6", responses[6]["id"])
+
+	// names are only calculated for the origins they are mapped to
+	assert.Equal("error", responses[7]["type"])
+	assert.Equal("error", responses[8]["type"])
+	assert.Equal(map[string]interface{}{"message": "GitHub:me is not mapped to https://example.com/login"}, responses[8]["error"])
+
+	assert.Equal(map[string]interface{}{"https://example.com": "touchy", "https://github.com": "GitHub:me"}, responses[9]["mappings"])
+	assert.Equal("error", responses[10]["type"])
+
+	// mappings are persisted
+	config, err = LoadConfig(path)
+	require.NoError(err)
+	assert.Equal("GitHub:me", config.Lookup("https://github.com/"))
+
+	responses = exchange(t, New(&testAuthenticator{}, config), `{"type": "unmap", "origin": "https://github.com"}`)
+	assert.Equal("unmap", responses[0]["type"])
+
+	config, err = LoadConfig(path)
+	require.NoError(err)
+	assert.Equal(map[string]string{"https://example.com": "touchy"}, config.Mappings())
+
+}
+
+func TestOrigin(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		URL    string
+		Origin string
+	}{
+		{"https://github.com/login?x=1", "https://github.com"},
+		{"HTTPS://GitHub.com:443", "https://github.com"},
+		{"http://localhost:8080/", "http://localhost:8080"},
+		{"http://[::1]:80/", "http://[::1]"},
+		{"github.com", ""},
+	} {
+
+		origin, err := Origin(test.URL)
+
+		if test.Origin == "" {
+			assert.Error(err, test.URL)
+		} else {
+			assert.Equal(test.Origin, origin, test.URL)
+		}
+
+	}
+
+}
@@ -0,0 +1,157 @@
+// Package otp implements HOTP (RFC 4226) and TOTP (RFC 6238) in software,
+// mirroring the calculations of the YubiKey OATH applet. It can be used to
+// cross-check codes calculated on a device or to calculate codes on machines
+// without one.
+package otp
+
+import (
+	"fmt"
+	"hash"
+	"time"
+
+	"github.com/yawn/ykoath"
+	"github.com/yawn/ykoath/internal/hotp"
+)
+
+const (
+
+	// Decimal encodes codes as decimal digits (default)
+	Decimal Encoding = iota
+
+	// Steam encodes codes as five characters like Steam Guard does
+	Steam
+)
+
+const (
+	// DefaultPeriod is the default TOTP period (in seconds)
+	DefaultPeriod = 30
+
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+	steamDigits   = 5
+)
+
+const (
+	errUnknownAlgorithm = "unsupported algorithm (%s)"
+	errUnknownType      = "unsupported type (%s)"
+	errInvalidDigits    = "invalid number of digits (%d not in 6..8)"
+	errInvalidPeriod    = "invalid period (%d < 0)"
+	errNotTotp          = "not a TOTP credential (%s)"
+)
+
+// Encoding denotes how the truncated HMAC value is turned into a code
+type Encoding int
+
+// Params describes how codes are derived
+type Params struct {
+	Algorithm ykoath.Algorithm
+	Digits    int
+	Encoding  Encoding
+	Period    int
+	Type      ykoath.Type
+}
+
+// Hash returns the hash function of an algorithm
+func Hash(a ykoath.Algorithm) (func() hash.Hash, error) {
+
+	if h := a.Hash(); h != nil {
+		return h, nil
+	}
+
+	return nil, fmt.Errorf(errUnknownAlgorithm, a)
+
+}
+
+// Validate checks the parameters for consistency
+func (p Params) Validate() error {
+
+	if _, err := Hash(p.Algorithm); err != nil {
+		return err
+	}
+
+	if p.Type != ykoath.Hotp && p.Type != ykoath.Totp {
+		return fmt.Errorf(errUnknownType, p.Type)
+	}
+
+	if p.Encoding == Decimal && (p.Digits < 6 || p.Digits > 8) {
+		return fmt.Errorf(errInvalidDigits, p.Digits)
+	}
+
+	if p.Period < 0 {
+		return fmt.Errorf(errInvalidPeriod, p.Period)
+	}
+
+	return nil
+
+}
+
+// HOTP calculates the code for a counter value (or, for TOTP, a time step)
+func (p Params) HOTP(key []byte, counter uint64) (string, error) {
+
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	value := hotp.Truncate(p.Algorithm.Hash(), key, counter)
+
+	if p.Encoding == Steam {
+		return steam(value), nil
+	}
+
+	return hotp.Decimal(value, p.Digits), nil
+
+}
+
+// TOTP calculates the code for a point in time
+func (p Params) TOTP(key []byte, t time.Time) (string, error) {
+
+	if p.Type != ykoath.Totp {
+		return "", fmt.Errorf(errNotTotp, p.Type)
+	}
+
+	return p.HOTP(key, p.Step(t))
+
+}
+
+// Step returns the TOTP time step (the number of periods since the epoch) for
+// a point in time
+func (p Params) Step(t time.Time) uint64 {
+	return uint64(t.Unix() / int64(p.period()))
+}
+
+// Window returns the window a TOTP code calculated for a point in time is
+// valid in (from inclusive, to exclusive)
+func (p Params) Window(t time.Time) (time.Time, time.Time) {
+
+	var (
+		period = int64(p.period())
+		from   = t.Unix() / period * period
+	)
+
+	return time.Unix(from, 0), time.Unix(from+period, 0)
+
+}
+
+// period returns the period or the default period
+func (p Params) period() int {
+
+	if p.Period == 0 {
+		return DefaultPeriod
+	}
+
+	return p.Period
+
+}
+
+// steam encodes a truncated value with the Steam Guard alphabet
+func steam(value uint32) string {
+
+	code := make([]byte, steamDigits)
+
+	for idx := range code {
+		code[idx] = steamAlphabet[value%uint32(len(steamAlphabet))]
+		value /= uint32(len(steamAlphabet))
+	}
+
+	return string(code)
+
+}
@@ -0,0 +1,157 @@
+package otp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+)
+
+var (
+	sha1Key   = []byte("12345678901234567890")
+	sha256Key = []byte("12345678901234567890123456789012")
+	sha512Key = []byte("1234567890123456789012345678901234567890123456789012345678901234")
+)
+
+func TestHOTP(t *testing.T) {
+
+	assert := assert.New(t)
+
+	// RFC 4226, appendix D
+	for counter, expected := range []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	} {
+
+		code, err := Params{
+			Algorithm: ykoath.HmacSha1,
+			Digits:    6,
+			Type:      ykoath.Hotp,
+		}.HOTP(sha1Key, uint64(counter))
+
+		assert.NoError(err)
+		assert.Equal(expected, code)
+
+	}
+
+}
+
+func TestTOTP(t *testing.T) {
+
+	assert := assert.New(t)
+
+	// the vectors of TestPutAndCalculateTestVector, followed by the remaining
+	// ones of RFC 6238, appendix B
+	for _, v := range []struct {
+		a      ykoath.Algorithm
+		key    []byte
+		digits int
+		time   int64
+		code   string
+	}{
+		{ykoath.HmacSha1, sha1Key, 6, 59, "287082"},
+		{ykoath.HmacSha256, sha256Key, 6, 59, "119246"},
+		{ykoath.HmacSha512, sha512Key, 6, 59, "693936"},
+		{ykoath.HmacSha1, sha1Key, 8, 59, "94287082"},
+		{ykoath.HmacSha256, sha256Key, 8, 59, "46119246"},
+		{ykoath.HmacSha512, sha512Key, 8, 59, "90693936"},
+		{ykoath.HmacSha1, sha1Key, 8, 1111111109, "07081804"},
+		{ykoath.HmacSha256, sha256Key, 8, 1111111109, "68084774"},
+		{ykoath.HmacSha512, sha512Key, 8, 1111111109, "25091201"},
+		{ykoath.HmacSha1, sha1Key, 8, 1111111111, "14050471"},
+		{ykoath.HmacSha256, sha256Key, 8, 1111111111, "67062674"},
+		{ykoath.HmacSha512, sha512Key, 8, 1111111111, "99943326"},
+		{ykoath.HmacSha1, sha1Key, 8, 1234567890, "89005924"},
+		{ykoath.HmacSha256, sha256Key, 8, 1234567890, "91819424"},
+		{ykoath.HmacSha512, sha512Key, 8, 1234567890, "93441116"},
+		{ykoath.HmacSha1, sha1Key, 8, 2000000000, "69279037"},
+		{ykoath.HmacSha256, sha256Key, 8, 2000000000, "90698825"},
+		{ykoath.HmacSha512, sha512Key, 8, 2000000000, "38618901"},
+		{ykoath.HmacSha1, sha1Key, 8, 20000000000, "65353130"},
+		{ykoath.HmacSha256, sha256Key, 8, 20000000000, "77737706"},
+		{ykoath.HmacSha512, sha512Key, 8, 20000000000, "47863826"},
+	} {
+
+		code, err := Params{
+			Algorithm: v.a,
+			Digits:    v.digits,
+			Type:      ykoath.Totp,
+		}.TOTP(v.key, time.Unix(v.time, 0))
+
+		assert.NoError(err)
+		assert.Equal(v.code, code, "%s at %d", v.a, v.time)
+
+	}
+
+}
+
+func TestTOTPPeriod(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := Params{
+		Algorithm: ykoath.HmacSha1,
+		Digits:    8,
+		Period:    60,
+		Type:      ykoath.Totp,
+	}
+
+	// time step 1 with a period of 60 seconds equals time step 1 with the
+	// default period
+	code, err := p.TOTP(sha1Key, time.Unix(119, 0))
+
+	assert.NoError(err)
+	assert.Equal("94287082", code)
+
+	from, to := p.Window(time.Unix(119, 0))
+
+	assert.Equal(time.Unix(60, 0), from)
+	assert.Equal(time.Unix(120, 0), to)
+
+}
+
+func TestSteam(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := Params{
+		Algorithm: ykoath.HmacSha1,
+		Encoding:  Steam,
+		Type:      ykoath.Totp,
+	}
+
+	code, err := p.TOTP(sha1Key, time.Unix(59, 0))
+
+	assert.NoError(err)
+	assert.Equal("PV9M4", code)
+
+	code, err = p.TOTP(sha1Key, time.Unix(1111111109, 0))
+
+	assert.NoError(err)
+	assert.Equal("PY4YB", code)
+
+}
+
+func TestValidate(t *testing.T) {
+
+	for _, p := range []Params{
+		{Algorithm: 0x04, Digits: 6, Type: ykoath.Totp},
+		{Algorithm: ykoath.HmacSha1, Digits: 5, Type: ykoath.Totp},
+		{Algorithm: ykoath.HmacSha1, Digits: 9, Type: ykoath.Totp},
+		{Algorithm: ykoath.HmacSha1, Digits: 6, Type: 0x30},
+		{Algorithm: ykoath.HmacSha1, Digits: 6, Period: -1, Type: ykoath.Totp},
+	} {
+		require.Error(t, p.Validate(), "%+v", p)
+	}
+
+	_, err := Params{
+		Algorithm: ykoath.HmacSha1,
+		Digits:    6,
+		Type:      ykoath.Hotp,
+	}.TOTP(sha1Key, time.Unix(59, 0))
+
+	assert.Error(t, err)
+
+}
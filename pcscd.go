@@ -0,0 +1,59 @@
+//go:build pcscd
+
+package ykoath
+
+import (
+	"github.com/yawn/ykoath/internal/pcsc"
+)
+
+var (
+	errResetCard   error = pcsc.ErrResetCard
+	errRemovedCard error = pcsc.ErrRemovedCard
+)
+
+// pcscdContext adapts a pcscd context to the context interface
+type pcscdContext struct {
+	*pcsc.Context
+}
+
+// pcscdCard adapts a pcscd card to the card interface
+type pcscdCard struct {
+	*pcsc.Card
+}
+
+// establishContext establishes a PC/SC context by talking to pcscd
+// directly, without cgo
+func establishContext() (context, error) {
+
+	context, err := pcsc.EstablishContext()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pcscdContext{context}, nil
+
+}
+
+// Connect connects to a reader in shared mode, using any protocol
+func (c *pcscdContext) Connect(reader string) (card, error) {
+
+	card, err := c.Context.Connect(reader, pcsc.ShareShared, pcsc.ProtocolAny)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pcscdCard{card}, nil
+
+}
+
+// Disconnect disconnects from the card, leaving it as is
+func (c *pcscdCard) Disconnect() error {
+	return c.Card.Disconnect(pcsc.LeaveCard)
+}
+
+// Reconnect reconnects to the card in shared mode, using any protocol
+func (c *pcscdCard) Reconnect() error {
+	return c.Card.Reconnect(pcsc.ShareShared, pcsc.ProtocolAny, pcsc.LeaveCard)
+}
@@ -0,0 +1,207 @@
+package ykoath
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+
+	"github.com/pkg/errors"
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/yawn/ykoath/internal/hotp"
+)
+
+const (
+	defaultQRSize = 256
+
+	errNameExists             = "credential %s already exists"
+	errFailedToGenerateQR     = "failed to generate QR code"
+	errFailedToGenerateSecret = "failed to generate secret"
+	errFailedToVerify         = "failed to verify %s"
+	errFailedToRemove         = "failed to remove %s"
+	errProvisionMismatch      = "code calculated by the device does not match for %s"
+)
+
+// ProvisionSpec describes a credential to provision. Zero values default to
+// HMAC-SHA1, TOTP, 6 digits, a period of 30 seconds and a QR code of 256x256
+// pixels.
+type ProvisionSpec struct {
+	Account   string
+	Algorithm Algorithm
+	Digits    uint8
+	Issuer    string
+	Period    int
+	QRSize    int
+	Touch     bool
+	Type      Type
+
+	// TouchRequiredCallback is fired before the device calculates the
+	// verification code of credentials requiring touch
+	TouchRequiredCallback func(string) error
+}
+
+// Provisioned is a provisioned credential, its otpauth URI and a QR code (PNG)
+// of the URI for enrolling the same secret at the service
+type Provisioned struct {
+	Credential *CredentialData
+	QR         []byte
+	URI        string
+}
+
+// Provision generates a random secret of the size of the hash function of the
+// algorithm (as recommended by RFC 4226), stores the credential and verifies
+// a code calculated by the device against a code calculated in software. It
+// refuses to overwrite an existing credential of the same name. A stored
+// credential is deleted again if anything fails afterwards (e.g. verification
+// or the touch callback), since its secret is not returned. HOTP credentials use
+// their first counter value for verification, so the returned URI starts at
+// counter 1.
+func (o *OATH) Provision(spec ProvisionSpec) (p *Provisioned, err error) {
+
+	c := &CredentialData{
+		Account:   spec.Account,
+		Algorithm: spec.Algorithm,
+		Digits:    spec.Digits,
+		Issuer:    spec.Issuer,
+		Period:    spec.Period,
+		Type:      spec.Type,
+	}
+
+	if c.Algorithm == 0 {
+		c.Algorithm = HmacSha1
+	}
+
+	if c.Digits == 0 {
+		c.Digits = 6
+	}
+
+	if c.Period == 0 {
+		c.Period = defaultPeriod
+	}
+
+	if c.Type == 0 {
+		c.Type = Totp
+	}
+
+	if h := c.Algorithm.Hash(); h != nil {
+		c.Secret = make([]byte, h().Size())
+	}
+
+	if _, err := rand.Read(c.Secret); err != nil {
+		return nil, errors.Wrapf(err, errFailedToGenerateSecret)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if spec.Touch && spec.TouchRequiredCallback == nil {
+		return nil, errors.Wrapf(ErrTouchRequired, errFailedToVerify, c.Name())
+	}
+
+	size := spec.QRSize
+
+	if size == 0 {
+		size = defaultQRSize
+	}
+
+	if err := o.ensureNew(c.Name()); err != nil {
+		return nil, err
+	}
+
+	if err := o.PutCredential(c, spec.Touch); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+
+		if err == nil {
+			return
+		}
+
+		if derr := o.Delete(c.Name()); derr != nil {
+			err = errors.Wrapf(err, errFailedToRemove, c.Name())
+		}
+
+	}()
+
+	if err := o.verifyProvisioned(c, spec); err != nil {
+		return nil, err
+	}
+
+	if c.Type == Hotp {
+		c.Counter++
+	}
+
+	uri := c.URI()
+
+	qr, err := qrcode.Encode(uri, qrcode.Medium, size)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToGenerateQR)
+	}
+
+	return &Provisioned{
+		Credential: c,
+		QR:         qr,
+		URI:        uri,
+	}, nil
+
+}
+
+// ensureNew makes sure the key does not hold a credential of the name yet
+func (o *OATH) ensureNew(name string) error {
+
+	names, err := o.List()
+
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+
+		if n.Name == name {
+			return errors.Errorf(errNameExists, name)
+		}
+
+	}
+
+	return nil
+
+}
+
+// verifyProvisioned compares a code calculated by the device with a code
+// calculated in software
+func (o *OATH) verifyProvisioned(c *CredentialData, spec ProvisionSpec) error {
+
+	var (
+		name    = c.Name()
+		now     = o.Clock()
+		counter = uint64(c.Counter)
+	)
+
+	if spec.Touch {
+
+		if err := spec.TouchRequiredCallback(name); err != nil {
+			return err
+		}
+
+	}
+
+	if c.Type == Totp {
+		counter = uint64(now.Unix() / int64(c.Period))
+	}
+
+	code, err := o.calculateAt(name, now)
+
+	if err != nil {
+		return errors.Wrapf(err, errFailedToVerify, name)
+	}
+
+	expected := hotp.Decimal(hotp.Truncate(c.Algorithm.Hash(), c.Secret, counter), int(c.Digits))
+
+	if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) != 1 {
+		return errors.Errorf(errProvisionMismatch, name)
+	}
+
+	return nil
+
+}
@@ -1,23 +1,43 @@
 package ykoath
 
 import (
+	"encoding/binary"
 	"fmt"
 )
 
 const errNametooLong = "name too long (%d > 64)"
 
 // Put sends a "PUT" instruction, storing a new / overwriting an existing OATH
-// credentials with an algorithm and type, 6 or 8 digits one-time password,
-// shared secrets and touch-required bit
+// credentials with an algorithm and type, 6 to 8 digits one-time password,
+// shared secrets and touch-required bit. Keys longer than the block size of
+// the algorithm are hashed and keys shorter than 14 bytes are padded, so codes
+// match those of other implementations.
 func (o *OATH) Put(name string, a Algorithm, t Type, digits uint8, key []byte, touch bool) error {
+	return o.put(name, a, t, digits, key, touch, 0)
+}
+
+// put implements the "PUT" instruction, including the initial moving factor
+// (counter) of HOTP credentials
+func (o *OATH) put(name string, a Algorithm, t Type, digits uint8, key []byte, touch bool, counter uint32) error {
 
 	if l := len(name); l > 64 {
 		return fmt.Errorf(errNametooLong, l)
 	}
 
+	if err := validate(a, t, digits); err != nil {
+		return err
+	}
+
+	key, err := prepareKey(a, key)
+
+	if err != nil {
+		return err
+	}
+
 	var (
 		alg = (0xf0|byte(a))&0x0f | byte(t)
 		dig = byte(digits)
+		imf []byte
 		prp []byte
 	)
 
@@ -25,10 +45,17 @@ func (o *OATH) Put(name string, a Algorithm, t Type, digits uint8, key []byte, t
 		prp = write(0x78, []byte{0x02})
 	}
 
-	_, err := o.send(0x00, 0x01, 0x00, 0x00,
+	if counter > 0 {
+		imf = write(0x7a, binary.BigEndian.AppendUint32(nil, counter))
+	}
+
+	o.cache = nil
+
+	_, err = o.send(0x00, 0x01, 0x00, 0x00,
 		write(0x71, []byte(name)),
 		write(0x73, []byte{alg, dig}, key),
 		prp,
+		imf,
 	)
 
 	return err
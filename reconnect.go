@@ -0,0 +1,134 @@
+package ykoath
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// ReconnectNever leaves recovering from a reset or removed card to the
+	// caller (default)
+	ReconnectNever Reconnect = iota
+
+	// ReconnectReader reconnects to the reader the session was opened on
+	ReconnectReader
+
+	// ReconnectSerial reconnects to the key with the same serial on any reader,
+	// falling back to ReconnectReader if the serial was never read
+	ReconnectSerial
+)
+
+const errFailedToFindSerial = "no key with serial %s found (out of %d readers)"
+
+// Reconnect denotes the policy used to recover a session after the card has
+// been reset by another application or briefly removed
+type Reconnect int
+
+// retryable indicates if an instruction can be safely retried after err, i.e.
+// the card has been reset or removed, a reconnect policy is set and the
+// instruction does not modify the device (SELECT, LIST, CALCULATE and
+// CALCULATE ALL)
+func (o *OATH) retryable(ins byte, err error) bool {
+
+	if o.Reconnect == ReconnectNever || o.recovering {
+		return false
+	}
+
+	switch errors.Cause(err) {
+	case errResetCard, errRemovedCard:
+	default:
+		return false
+	}
+
+	switch ins {
+	case 0xa1, 0xa2, 0xa4:
+		return true
+	default:
+		return false
+	}
+
+}
+
+// recover reconnects the session according to the reconnect policy,
+// re-selects the OATH applet and unlocks it again if an access key is known
+func (o *OATH) recover() error {
+
+	o.recovering = true
+	defer func() { o.recovering = false }()
+
+	// this may be a different key now
+	o.cache = nil
+
+	// a reset card keeps its handle, so reconnecting in place is sufficient
+	if err := o.card.Reconnect(); err != nil {
+
+		// the handle is gone for good - this is a removed (and maybe
+		// re-inserted) card
+		_ = o.card.Disconnect()
+
+		if o.context == nil {
+			return err
+		}
+
+		card, err := o.connect()
+
+		if err != nil {
+			return err
+		}
+
+		o.card = card
+
+	}
+
+	s, err := o.Select()
+
+	if err != nil || o.accessKey == nil {
+		return err
+	}
+
+	return o.unlock(s, o.accessKey)
+
+}
+
+// connect connects to a new card according to the reconnect policy
+func (o *OATH) connect() (card, error) {
+
+	if o.Reconnect == ReconnectReader || o.serial == "" {
+		return o.context.Connect(o.reader)
+	}
+
+	readers, err := o.context.ListReaders()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToListReaders)
+	}
+
+	for _, reader := range readers {
+
+		if !strings.Contains(strings.ToLower(reader), "yubikey") {
+			continue
+		}
+
+		card, err := o.context.Connect(reader)
+
+		if err != nil {
+			continue
+		}
+
+		candidate := &OATH{card: card}
+
+		if serial, err := candidate.Serial(); err == nil && serial == o.serial {
+			o.reader = reader
+			return card, nil
+		}
+
+		_ = card.Disconnect()
+
+	}
+
+	return nil, fmt.Errorf(errFailedToFindSerial, o.serial, len(readers))
+
+}
@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath/internal/wire"
+)
+
+// Client relays APDUs to a remote server and implements ykoath.Transport
+type Client struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+// Dial connects to a server. If config is not nil, the connection uses TLS and
+// config should carry a client certificate for mutual TLS.
+func Dial(network, address string, config *tls.Config) (*Client, error) {
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if config != nil {
+		conn, err = tls.Dial(network, address, config)
+	} else {
+		conn, err = net.Dial(network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn: conn,
+	}, nil
+
+}
+
+// Transmit sends an APDU to the remote device and returns its response
+func (c *Client) Transmit(apdu []byte) ([]byte, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := wire.WriteFrame(c.conn, apdu); err != nil {
+		return nil, err
+	}
+
+	res, err := wire.ReadFrame(c.conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New(errEmptyFrame)
+	}
+
+	switch res[0] {
+	case frameResponse:
+		return res[1:], nil
+	case frameError:
+		return nil, fmt.Errorf(errRemote, res[1:])
+	default:
+		return nil, fmt.Errorf(errFrameType, res[0])
+	}
+
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
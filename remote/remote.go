@@ -0,0 +1,112 @@
+// Package remote relays OATH APDUs over a network socket, allowing a session
+// on one machine to use a YubiKey connected to another.
+//
+// The server wraps a local transport (e.g. an *ykoath.OATH session) and
+// forwards only allowlisted instructions. The client is a ykoath.Transport,
+// so ykoath.NewWithTransport turns it into a regular OATH session.
+package remote
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// Put stores a new or overwrites an existing credential
+	Put Instruction = 0x01
+
+	// Delete removes a credential
+	Delete Instruction = 0x02
+
+	// SetCode sets or removes the access key
+	SetCode Instruction = 0x03
+
+	// Reset removes all credentials and the access key
+	Reset Instruction = 0x04
+
+	// Rename renames a credential
+	Rename Instruction = 0x05
+
+	// List lists all credentials
+	List Instruction = 0xa1
+
+	// Calculate calculates a single code
+	Calculate Instruction = 0xa2
+
+	// Validate unlocks a device protected by an access key
+	Validate Instruction = 0xa3
+
+	// CalculateAll calculates all codes
+	CalculateAll Instruction = 0xa4
+)
+
+const (
+	frameResponse = 0x00
+	frameError    = 0x01
+)
+
+const (
+	errEmptyFrame      = "empty frame"
+	errFrameType       = "unknown frame type (%x)"
+	errMissingClientCA = "mutual TLS requires ClientCAs"
+	errRemote          = "remote error: %s"
+)
+
+// Instruction denotes an OATH instruction the server may forward. Selecting
+// the OATH applet is always allowed. Chained responses are fetched by the
+// server and relayed as a whole.
+type Instruction byte
+
+// String returns a string representation of the instruction
+func (i Instruction) String() string {
+
+	switch i {
+	case Put:
+		return "PUT"
+	case Delete:
+		return "DELETE"
+	case SetCode:
+		return "SET CODE"
+	case Reset:
+		return "RESET"
+	case Rename:
+		return "RENAME"
+	case List:
+		return "LIST"
+	case Calculate:
+		return "CALCULATE"
+	case Validate:
+		return "VALIDATE"
+	case CalculateAll:
+		return "CALCULATE ALL"
+	default:
+		return fmt.Sprintf("unknown %x", byte(i))
+	}
+
+}
+
+// Listen announces on the local network address. If config is not nil, the
+// listener uses TLS and requires verified client certificates (mutual TLS).
+func Listen(network, address string, config *tls.Config) (net.Listener, error) {
+
+	l, err := net.Listen(network, address)
+
+	if err != nil || config == nil {
+		return l, err
+	}
+
+	if config.ClientCAs == nil {
+		l.Close()
+		return nil, errors.New(errMissingClientCA)
+	}
+
+	config = config.Clone()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return tls.NewListener(l, config), nil
+
+}
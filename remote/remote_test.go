@@ -0,0 +1,289 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+)
+
+// testTransport answers APDUs from a fixed transcript
+type testTransport struct {
+	mu        sync.Mutex
+	responses map[string][][]byte
+	transmits [][]byte
+}
+
+func (t *testTransport) Transmit(apdu []byte) ([]byte, error) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.transmits = append(t.transmits, apdu)
+
+	key := fmt.Sprintf("% x", apdu)
+	res := t.responses[key]
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("unexpected APDU %s", key)
+	}
+
+	t.responses[key] = res[1:]
+
+	return res[0], nil
+
+}
+
+func (t *testTransport) Close() error {
+	return nil
+}
+
+func serve(t *testing.T, s *Server, config *tls.Config) string {
+
+	l, err := Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { l.Close() })
+
+	go s.Serve(l)
+
+	return l.Addr().String()
+
+}
+
+func TestRelay(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		transport = &testTransport{
+			responses: map[string][][]byte{
+				"00 a4 04 00 07 a0 00 00 05 27 21 01": {
+					{0x79, 0x03, 0x04, 0x03, 0x03, 0x90, 0x00},
+				},
+				"00 a1 00 00": {
+					{0x72, 0x05, 0x21, 0x74, 0x65, 0x61, 0x02},
+				},
+				"00 a5 00 00": {
+					{0x73, 0x74, 0x90, 0x00},
+				},
+			},
+		}
+	)
+
+	addr := serve(t, NewServer(transport, List, Calculate, CalculateAll), nil)
+
+	client, err := Dial("tcp", addr, nil)
+	require.NoError(err)
+
+	oath := ykoath.NewWithTransport(client)
+	defer oath.Close()
+
+	res, err := oath.Select()
+	require.NoError(err)
+
+	assert.Equal([]byte{0x04, 0x03, 0x03}, res.Version)
+
+	names, err := oath.List()
+	require.NoError(err)
+
+	require.Len(names, 1)
+	assert.Equal("test", names[0].Name)
+	assert.Equal(ykoath.HmacSha1, names[0].Algorithm)
+	assert.Equal(ykoath.Totp, names[0].Type)
+
+	err = oath.Put("test", ykoath.HmacSha1, ykoath.Totp, 6, []byte("12345678901234567890"), false)
+	assert.EqualError(err, "unknown (6d 00)")
+
+	err = oath.Delete("test")
+	assert.EqualError(err, "unknown (6d 00)")
+
+	// selecting other applets is never forwarded
+	res2, err := oath.Transmit([]byte{0x00, 0xa4, 0x04, 0x00, 0x08, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x47, 0x11, 0x17})
+	require.NoError(err)
+
+	assert.Equal([]byte{0x6d, 0x00}, res2)
+
+	// neither is fetching remaining data outside of a chained response
+	res2, err = oath.Transmit([]byte{0x00, 0xa5, 0x00, 0x00})
+	require.NoError(err)
+
+	assert.Equal([]byte{0x6d, 0x00}, res2)
+
+	assert.Len(transport.transmits, 3)
+
+}
+
+func TestRelayError(t *testing.T) {
+
+	transport := &testTransport{
+		responses: map[string][][]byte{},
+	}
+
+	addr := serve(t, NewServer(transport, List), nil)
+
+	client, err := Dial("tcp", addr, nil)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	_, err = client.Transmit([]byte{0x00, 0xa1, 0x00, 0x00})
+
+	assert.EqualError(t, err, "remote error: unexpected APDU 00 a1 00 00")
+
+}
+
+func TestRelayMutualTLS(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		transport = &testTransport{
+			responses: map[string][][]byte{
+				"00 a4 04 00 07 a0 00 00 05 27 21 01": {
+					{0x79, 0x03, 0x04, 0x03, 0x03, 0x90, 0x00},
+				},
+			},
+		}
+		ca, caKey = certificate(t, nil, nil)
+		pool      = x509.NewCertPool()
+	)
+
+	pool.AddCert(ca)
+
+	_, err := Listen("tcp", "127.0.0.1:0", &tls.Config{})
+	assert.EqualError(err, "mutual TLS requires ClientCAs")
+
+	serverCert, serverKey := certificate(t, ca, caKey)
+	clientCert, clientKey := certificate(t, ca, caKey)
+
+	addr := serve(t, NewServer(transport), &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    pool,
+	})
+
+	// without a client certificate, the handshake fails on first use
+	client, err := Dial("tcp", addr, &tls.Config{RootCAs: pool})
+
+	if err == nil {
+		_, err = client.Transmit([]byte{0x00, 0xa4, 0x04, 0x00, 0x07, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01})
+		client.Close()
+	}
+
+	assert.Error(err)
+
+	client, err = Dial("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}},
+		RootCAs:      pool,
+	})
+	require.NoError(err)
+
+	oath := ykoath.NewWithTransport(client)
+	defer oath.Close()
+
+	res, err := oath.Select()
+	require.NoError(err)
+
+	assert.Equal([]byte{0x04, 0x03, 0x03}, res.Version)
+
+}
+
+func TestRelayStallingClient(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		transport = &testTransport{
+			responses: map[string][][]byte{
+				"00 a4 04 00 07 a0 00 00 05 27 21 01": {
+					{0x79, 0x03, 0x04, 0x03, 0x03, 0x90, 0x00},
+				},
+				"00 a1 00 00": {
+					{0x72, 0x05, 0x21, 0x74, 0x65, 0x61, 0x02},
+				},
+				"00 a5 00 00": {
+					{0x73, 0x74, 0x90, 0x00},
+				},
+			},
+		}
+	)
+
+	addr := serve(t, NewServer(transport, List), nil)
+
+	stalling, err := Dial("tcp", addr, nil)
+	require.NoError(err)
+
+	defer stalling.Close()
+
+	// the chained response is fetched by the server, the client never sends
+	// SEND REMAINING
+	res, err := stalling.Transmit([]byte{0x00, 0xa1, 0x00, 0x00})
+	require.NoError(err)
+
+	assert.Equal([]byte{0x72, 0x05, 0x21, 0x74, 0x65, 0x73, 0x74, 0x90, 0x00}, res)
+
+	client, err := Dial("tcp", addr, nil)
+	require.NoError(err)
+
+	defer client.Close()
+
+	done := make(chan error)
+
+	go func() {
+		_, err := client.Transmit([]byte{0x00, 0xa4, 0x04, 0x00, 0x07, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("transport still locked by stalling client")
+	}
+
+}
+
+// certificate creates a CA certificate (if parent is nil) or a certificate
+// for 127.0.0.1 signed by the parent
+func certificate(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "ykoath"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+
+}
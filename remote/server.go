@@ -0,0 +1,143 @@
+package remote
+
+import (
+	"bytes"
+	"net"
+	"sync"
+
+	"github.com/yawn/ykoath"
+	"github.com/yawn/ykoath/internal/wire"
+)
+
+var (
+
+	// selectOATH is the SELECT APDU header and AID of the OATH applet
+	selectOATH = []byte{0x00, 0xa4, 0x04, 0x00, 0x07, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01}
+
+	// statusDenied is returned for APDUs the server does not forward
+	// ("instruction not supported")
+	statusDenied = []byte{0x6d, 0x00}
+)
+
+// Server relays APDUs from remote clients to a local transport
+type Server struct {
+	Debug     func(string, ...interface{})
+	allow     map[Instruction]bool
+	mu        sync.Mutex
+	transport ykoath.Transport
+}
+
+// NewServer creates a server forwarding the allowed instructions to a local
+// transport
+func NewServer(t ykoath.Transport, allow ...Instruction) *Server {
+
+	s := &Server{
+		allow:     make(map[Instruction]bool, len(allow)),
+		transport: t,
+	}
+
+	for _, ins := range allow {
+		s.allow[ins] = true
+	}
+
+	return s
+
+}
+
+// Serve accepts connections on the listener and serves each of them in its own
+// goroutine, until the listener is closed
+func (s *Server) Serve(l net.Listener) error {
+
+	for {
+
+		conn, err := l.Accept()
+
+		if err != nil {
+			return err
+		}
+
+		go s.serve(conn)
+
+	}
+
+}
+
+// serve relays the APDUs of a single connection
+func (s *Server) serve(conn net.Conn) {
+
+	defer conn.Close()
+
+	for {
+
+		apdu, err := wire.ReadFrame(conn)
+
+		if err != nil {
+			return
+		}
+
+		if !s.allowed(apdu) {
+
+			s.debug("DENY %s % x", conn.RemoteAddr(), apdu)
+
+			if err := wire.WriteFrame(conn, []byte{frameResponse}, statusDenied); err != nil {
+				return
+			}
+
+			continue
+
+		}
+
+		s.debug("RELAY %s % x", conn.RemoteAddr(), apdu)
+
+		res, err := s.transmit(apdu)
+
+		if err != nil {
+			err = wire.WriteFrame(conn, []byte{frameError}, []byte(err.Error()))
+		} else {
+			err = wire.WriteFrame(conn, []byte{frameResponse}, res)
+		}
+
+		if err != nil {
+			return
+		}
+
+	}
+
+}
+
+// transmit relays an APDU with the transport locked, fetching all parts of a
+// chained response itself so a stalling client cannot keep the transport
+// locked
+func (s *Server) transmit(apdu []byte) ([]byte, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return wire.Transmit(s.transport, apdu)
+
+}
+
+// allowed indicates if an APDU may be forwarded
+func (s *Server) allowed(apdu []byte) bool {
+
+	if len(apdu) < 4 {
+		return false
+	}
+
+	// SELECT shares its instruction with CALCULATE ALL
+	if apdu[1] == 0xa4 && apdu[2] == 0x04 {
+		return bytes.Equal(apdu, selectOATH)
+	}
+
+	return s.allow[Instruction(apdu[1])]
+
+}
+
+// debug logs if a debugger is set
+func (s *Server) debug(format string, args ...interface{}) {
+
+	if s.Debug != nil {
+		s.Debug(format, args...)
+	}
+
+}
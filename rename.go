@@ -0,0 +1,24 @@
+package ykoath
+
+import (
+	"fmt"
+)
+
+// Rename sends a "RENAME" instruction, renaming one named OATH credential
+// (requires firmware 5.3 or later)
+func (o *OATH) Rename(from, to string) error {
+
+	if l := len(to); l > 64 {
+		return fmt.Errorf(errNametooLong, l)
+	}
+
+	o.cache = nil
+
+	_, err := o.send(0x00, 0x05, 0x00, 0x00,
+		write(0x71, []byte(from)),
+		write(0x71, []byte(to)),
+	)
+
+	return err
+
+}
@@ -0,0 +1,14 @@
+package ykoath
+
+// Reset sends a "RESET" instruction, removing all OATH credentials and the
+// password of the device
+func (o *OATH) Reset() error {
+
+	o.accessKey = nil
+	o.cache = nil
+
+	_, err := o.send(0x00, 0x04, 0xde, 0xad)
+
+	return err
+
+}
@@ -0,0 +1,59 @@
+//go:build !pcscd
+
+package ykoath
+
+import (
+	"github.com/ebfe/scard"
+)
+
+var (
+	errResetCard   error = scard.ErrResetCard
+	errRemovedCard error = scard.ErrRemovedCard
+)
+
+// scardContext adapts a libpcsclite (or WinSCard) context to the context
+// interface
+type scardContext struct {
+	*scard.Context
+}
+
+// scardCard adapts a libpcsclite (or WinSCard) card to the card interface
+type scardCard struct {
+	*scard.Card
+}
+
+// establishContext establishes a PC/SC context through github.com/ebfe/scard
+func establishContext() (context, error) {
+
+	context, err := scard.EstablishContext()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &scardContext{context}, nil
+
+}
+
+// Connect connects to a reader in shared mode, using any protocol
+func (c *scardContext) Connect(reader string) (card, error) {
+
+	card, err := c.Context.Connect(reader, scard.ShareShared, scard.ProtocolAny)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &scardCard{card}, nil
+
+}
+
+// Disconnect disconnects from the card, leaving it as is
+func (c *scardCard) Disconnect() error {
+	return c.Card.Disconnect(scard.LeaveCard)
+}
+
+// Reconnect reconnects to the card in shared mode, using any protocol
+func (c *scardCard) Reconnect() error {
+	return c.Card.Reconnect(scard.ShareShared, scard.ProtocolAny, scard.LeaveCard)
+}
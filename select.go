@@ -45,3 +45,22 @@ func (o *OATH) Select() (*Select, error) {
 	return s, nil
 
 }
+
+// VersionString returns the firmware version as dotted string, e.g. "5.4.3"
+func (s *Select) VersionString() string {
+
+	v := ""
+
+	for idx, b := range s.Version {
+
+		if idx > 0 {
+			v += "."
+		}
+
+		v += fmt.Sprint(b)
+
+	}
+
+	return v
+
+}
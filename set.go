@@ -0,0 +1,178 @@
+package ykoath
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const errFailedOnKey = "failed on key %s"
+
+// SetCalculation is a code calculated by one key out of a set of keys
+type SetCalculation struct {
+	Code   string
+	Name   string
+	Serial string
+}
+
+// setResult is the result of CALCULATE ALL on one key out of a set of keys
+type setResult struct {
+	codes  map[string]string
+	err    error
+	key    *OATH
+	serial string
+}
+
+// CalculateSet is a high-level function like Calculate, running CALCULATE ALL
+// concurrently on every key of a set (e.g. from NewSet) and returning the
+// code of the single key holding a matching credential. It fails with
+// ErrMultipleMatches if more than one key holds a matching credential.
+func CalculateSet(set []*OATH, name string, touchRequiredCallback func(string) error) (*SetCalculation, error) {
+
+	var (
+		results = make([]setResult, len(set))
+		wg      sync.WaitGroup
+	)
+
+	for idx, key := range set {
+
+		wg.Add(1)
+
+		go func(res *setResult, key *OATH) {
+			defer wg.Done()
+			res.key = key
+			res.serial, res.codes, res.err = key.calculateSet()
+		}(&results[idx], key)
+
+	}
+
+	wg.Wait()
+
+	var (
+		candidates []string
+		failure    error
+		found      *setResult
+		key        string
+	)
+
+	for idx := range results {
+
+		res := &results[idx]
+
+		if res.err != nil {
+
+			if failure == nil {
+				failure = errors.Wrapf(res.err, errFailedOnKey, res.serial)
+			}
+
+			continue
+
+		}
+
+		match, err := res.key.matchOne(name, sortedKeys(res.codes))
+
+		if errors.Is(err, ErrUnknownName) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, errFailedOnKey, res.serial)
+		}
+
+		candidates = append(candidates, fmt.Sprintf("%s on %s", match, res.serial))
+		found, key = res, match
+
+	}
+
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("%w (%s)", ErrMultipleMatches, strings.Join(candidates, ","))
+	}
+
+	if found == nil {
+
+		if failure != nil {
+			return nil, failure
+		}
+
+		return nil, fmt.Errorf("%w (%s)", ErrUnknownName, name)
+
+	}
+
+	calc := &SetCalculation{
+		Code:   found.codes[key],
+		Name:   key,
+		Serial: found.serial,
+	}
+
+	// CALCULATE ALL only uses the default period
+	period, _ := splitPeriod(key)
+
+	if calc.Code == touchRequired || calc.Code == hotpAccount || period != defaultPeriod {
+
+		if calc.Code == touchRequired {
+
+			if err := touchRequiredCallback(name); err != nil {
+				return nil, err
+			}
+
+		}
+
+		code, err := found.key.calculate(key)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, errFailedOnKey, found.serial)
+		}
+
+		calc.Code = code
+
+	}
+
+	return calc, nil
+
+}
+
+// calculateSet reads the serial of a key, (re-)selects the OATH applet and
+// runs CALCULATE ALL
+func (o *OATH) calculateSet() (string, map[string]string, error) {
+
+	serial, err := o.selectSet()
+
+	if err != nil {
+		return serial, nil, err
+	}
+
+	codes, err := o.calculateAll()
+
+	return serial, codes, err
+
+}
+
+// selectSet reads the serial of a key out of a set and (re-)selects the OATH
+// applet, unlocking it again with the access key of the session
+func (o *OATH) selectSet() (string, error) {
+
+	serial := o.serial
+
+	if serial == "" {
+
+		var err error
+
+		if serial, err = o.Serial(); err != nil {
+			return "", errors.Wrapf(err, errFailedToReadSerial)
+		}
+
+	}
+
+	s, err := o.Select()
+
+	if err != nil {
+		return serial, err
+	}
+
+	if s.IsLocked() && o.accessKey != nil {
+		return serial, o.unlock(s, o.accessKey)
+	}
+
+	return serial, nil
+
+}
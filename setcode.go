@@ -0,0 +1,64 @@
+package ykoath
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// SetPassword sends a "SET CODE" instruction, protecting the device with a
+// password. A locked device has to be unlocked first.
+func (o *OATH) SetPassword(password []byte) error {
+
+	s, err := o.Select()
+
+	if err != nil {
+		return err
+	}
+
+	if s.IsLocked() && o.accessKey != nil {
+
+		if err := o.unlock(s, o.accessKey); err != nil {
+			return err
+		}
+
+	}
+
+	var (
+		key       = DeriveKey(s.Name, password)
+		challenge = make([]byte, 8)
+	)
+
+	if _, err := rand.Read(challenge); err != nil {
+		return errors.Wrapf(err, errFailedToGenerateChallenge)
+	}
+
+	if _, err := o.send(0x00, 0x03, 0x00, 0x00,
+		write(0x73, []byte{byte(Totp) | byte(HmacSha1)}, key),
+		write(0x74, challenge),
+		write(0x75, hmacSha1(key, challenge)),
+	); err != nil {
+		return err
+	}
+
+	o.accessKey = key
+
+	return nil
+
+}
+
+// ClearPassword sends a "SET CODE" instruction removing the password of the
+// device. A locked device has to be unlocked first.
+func (o *OATH) ClearPassword() error {
+
+	if _, err := o.send(0x00, 0x03, 0x00, 0x00,
+		[]byte{0x73, 0x00},
+	); err != nil {
+		return err
+	}
+
+	o.accessKey = nil
+
+	return nil
+
+}
@@ -0,0 +1,446 @@
+// Package soft implements a file-backed software authenticator, keeping OATH
+// credentials encrypted at rest under a passphrase. It implements
+// ykoath.Authenticator and can stand in for a YubiKey on hosts without one.
+package soft
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yawn/ykoath"
+	"github.com/yawn/ykoath/otp"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	version = 1
+
+	keyLength  = 32
+	saltLength = 16
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// bounds of the scrypt parameters read from a store, as used by Aegis
+	scryptMaxN = 1 << 20
+	scryptMaxR = 8
+	scryptMaxP = 16
+)
+
+const (
+	errFailedToCalculate  = "failed to calculate %s"
+	errFailedToCreate     = "failed to create cipher"
+	errFailedToDecrypt    = "failed to decrypt store (wrong passphrase?)"
+	errFailedToDeriveKey  = "failed to derive key"
+	errFailedToEncrypt    = "failed to encrypt store"
+	errFailedToParse      = "failed to parse store %s"
+	errFailedToRead       = "failed to read store %s"
+	errFailedToReadRandom = "failed to read random bytes"
+	errFailedToWrite      = "failed to write store %s"
+	errInvalidCredential  = "invalid credential %s"
+	errInvalidParameters  = "invalid scrypt parameters (N=%d, r=%d, p=%d)"
+	errNameTooLong        = "name too long (%d > 64)"
+	errStoreClosed        = "store already closed"
+	errUnsupportedVersion = "unsupported store version (%d)"
+)
+
+var _ ykoath.Authenticator = (*Store)(nil)
+
+// Store is a file-backed software authenticator. Credentials are encrypted
+// with AES-GCM under a key derived from a passphrase with scrypt and written
+// to disk on every change.
+type Store struct {
+	Clock       func() time.Time
+	credentials map[string]*credential
+	key         []byte
+	Matcher     ykoath.Matcher
+	mu          sync.Mutex
+	n, r, p     int
+	path        string
+	salt        []byte
+}
+
+// credential is a stored OATH credential
+type credential struct {
+	Algorithm ykoath.Algorithm `json:"algorithm"`
+	Counter   uint64           `json:"counter,omitempty"`
+	Digits    uint8            `json:"digits"`
+	Key       []byte           `json:"key"`
+	Touch     bool             `json:"touch,omitempty"`
+	Type      ykoath.Type      `json:"type"`
+}
+
+// file is the on-disk representation of a store
+type file struct {
+	Data    []byte `json:"data"`
+	N       int    `json:"n"`
+	Nonce   []byte `json:"nonce"`
+	P       int    `json:"p"`
+	R       int    `json:"r"`
+	Salt    []byte `json:"salt"`
+	Version int    `json:"version"`
+}
+
+// Open opens the store at path, decrypting it with a passphrase. A store that
+// does not exist yet is created on the first Put.
+func Open(path string, passphrase []byte) (*Store, error) {
+
+	s := &Store{
+		Clock:       time.Now,
+		credentials: make(map[string]*credential),
+		n:           scryptN,
+		p:           scryptP,
+		path:        path,
+		r:           scryptR,
+	}
+
+	buf, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+
+		s.salt = make([]byte, saltLength)
+
+		if _, err := rand.Read(s.salt); err != nil {
+			return nil, errors.Wrapf(err, errFailedToReadRandom)
+		}
+
+		if s.key, err = scrypt.Key(passphrase, s.salt, s.n, s.r, s.p, keyLength); err != nil {
+			return nil, errors.Wrapf(err, errFailedToDeriveKey)
+		}
+
+		return s, nil
+
+	} else if err != nil {
+		return nil, errors.Wrapf(err, errFailedToRead, path)
+	}
+
+	var f file
+
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, errors.Wrapf(err, errFailedToParse, path)
+	}
+
+	if f.Version != version {
+		return nil, fmt.Errorf(errUnsupportedVersion, f.Version)
+	}
+
+	if f.N < 2 || f.N > scryptMaxN || f.N&(f.N-1) != 0 || f.R < 1 || f.R > scryptMaxR || f.P < 1 || f.P > scryptMaxP {
+		return nil, fmt.Errorf(errInvalidParameters, f.N, f.R, f.P)
+	}
+
+	s.n, s.p, s.r, s.salt = f.N, f.P, f.R, f.Salt
+
+	if s.key, err = scrypt.Key(passphrase, s.salt, s.n, s.r, s.p, keyLength); err != nil {
+		return nil, errors.Wrapf(err, errFailedToDeriveKey)
+	}
+
+	aead, err := s.aead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, f.Nonce, f.Data, nil)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToDecrypt)
+	}
+
+	if err := json.Unmarshal(plaintext, &s.credentials); err != nil {
+		return nil, errors.Wrapf(err, errFailedToParse, path)
+	}
+
+	return s, nil
+
+}
+
+// Calculate returns the code of the credential matching name, using the
+// configured Matcher like ykoath.OATH does. HOTP credentials advance their
+// counter. Software credentials cannot require a physical touch, so the
+// callback of credentials stored with touch serves as a confirmation prompt.
+func (s *Store) Calculate(name string, touchRequiredCallback func(string) error) (string, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil {
+		return "", errors.New(errStoreClosed)
+	}
+
+	key, err := s.matchOne(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	c := s.credentials[key]
+
+	if c.Touch {
+
+		if err := touchRequiredCallback(name); err != nil {
+			return "", err
+		}
+
+	}
+
+	params := otp.Params{
+		Algorithm: c.Algorithm,
+		Digits:    int(c.Digits),
+		Type:      c.Type,
+	}
+
+	if c.Type == ykoath.Hotp {
+
+		code, err := params.HOTP(c.Key, c.Counter)
+
+		if err != nil {
+			return "", errors.Wrapf(err, errFailedToCalculate, key)
+		}
+
+		c.Counter++
+
+		if err := s.save(); err != nil {
+			c.Counter--
+			return "", err
+		}
+
+		return code, nil
+
+	}
+
+	params.Period = (&ykoath.Name{Name: key, Type: c.Type}).Credential().Period
+
+	code, err := params.TOTP(c.Key, s.Clock())
+
+	if err != nil {
+		return "", errors.Wrapf(err, errFailedToCalculate, key)
+	}
+
+	return code, nil
+
+}
+
+// Close forgets the derived key; the store cannot be used afterwards
+func (s *Store) Close() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx := range s.key {
+		s.key[idx] = 0
+	}
+
+	s.credentials = nil
+	s.key = nil
+
+	return nil
+
+}
+
+// Delete removes one named credential
+func (s *Store) Delete(name string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil {
+		return errors.New(errStoreClosed)
+	}
+
+	if _, ok := s.credentials[name]; !ok {
+		return fmt.Errorf("%w (%s)", ykoath.ErrUnknownName, name)
+	}
+
+	delete(s.credentials, name)
+
+	return s.save()
+
+}
+
+// List returns all credentials, sorted by name
+func (s *Store) List() ([]*ykoath.Name, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil {
+		return nil, errors.New(errStoreClosed)
+	}
+
+	names := make([]*ykoath.Name, 0, len(s.credentials))
+
+	for _, name := range s.names() {
+
+		names = append(names, &ykoath.Name{
+			Algorithm: s.credentials[name].Algorithm,
+			Name:      name,
+			Type:      s.credentials[name].Type,
+		})
+
+	}
+
+	return names, nil
+
+}
+
+// Put stores a new / overwrites an existing credential, with the same
+// constraints as the device
+func (s *Store) Put(name string, a ykoath.Algorithm, t ykoath.Type, digits uint8, key []byte, touch bool) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil {
+		return errors.New(errStoreClosed)
+	}
+
+	if l := len(name); l > 64 {
+		return fmt.Errorf(errNameTooLong, l)
+	}
+
+	params := otp.Params{
+		Algorithm: a,
+		Digits:    int(digits),
+		Type:      t,
+	}
+
+	if err := params.Validate(); err != nil {
+		return errors.Wrapf(err, errInvalidCredential, name)
+	}
+
+	s.credentials[name] = &credential{
+		Algorithm: a,
+		Digits:    digits,
+		Key:       append([]byte(nil), key...),
+		Touch:     touch,
+		Type:      t,
+	}
+
+	return s.save()
+
+}
+
+// aead returns the cipher for the derived key
+func (s *Store) aead() (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(s.key)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToCreate)
+	}
+
+	return cipher.NewGCM(block)
+
+}
+
+// matchOne returns the single name matching a query
+func (s *Store) matchOne(query string) (string, error) {
+
+	matcher := s.Matcher
+
+	if matcher == nil {
+		matcher = ykoath.MatchExactThenSubstring
+	}
+
+	matches, err := matcher(query, s.names())
+
+	if err != nil {
+		return "", err
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w (%s)", ykoath.ErrUnknownName, query)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w (%s)", ykoath.ErrMultipleMatches, strings.Join(matches, ","))
+	}
+
+}
+
+// names returns the sorted names of all credentials
+func (s *Store) names() []string {
+
+	names := make([]string, 0, len(s.credentials))
+
+	for name := range s.credentials {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+
+}
+
+// save encrypts the credentials and atomically replaces the store on disk
+func (s *Store) save() error {
+
+	plaintext, err := json.Marshal(s.credentials)
+
+	if err != nil {
+		return errors.Wrapf(err, errFailedToEncrypt)
+	}
+
+	aead, err := s.aead()
+
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrapf(err, errFailedToReadRandom)
+	}
+
+	buf, err := json.Marshal(&file{
+		Data:    aead.Seal(nil, nonce, plaintext, nil),
+		N:       s.n,
+		Nonce:   nonce,
+		P:       s.p,
+		R:       s.r,
+		Salt:    s.salt,
+		Version: version,
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, errFailedToEncrypt)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+
+	if err != nil {
+		return errors.Wrapf(err, errFailedToWrite, s.path)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, errFailedToWrite, s.path)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, errFailedToWrite, s.path)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrapf(err, errFailedToWrite, s.path)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,148 @@
+package soft
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath"
+)
+
+func TestStore(t *testing.T) {
+
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		path       = filepath.Join(t.TempDir(), "store.json")
+		passphrase = []byte("correct horse battery staple")
+		key        = []byte("12345678901234567890")
+		touched    []string
+	)
+
+	var a ykoath.Authenticator
+
+	s, err := Open(path, passphrase)
+	require.NoError(err)
+
+	s.Clock = func() time.Time {
+		return time.Unix(59, 0)
+	}
+
+	a = s
+
+	require.NoError(a.Put("testvector", ykoath.HmacSha1, ykoath.Totp, 8, key, false))
+	require.NoError(a.Put("60/long", ykoath.HmacSha1, ykoath.Totp, 8, key, false))
+	require.NoError(a.Put("counter", ykoath.HmacSha1, ykoath.Hotp, 6, key, false))
+	require.NoError(a.Put("touchy", ykoath.HmacSha256, ykoath.Totp, 6, []byte("12345678901234567890123456789012"), true))
+
+	assert.Error(a.Put("digits", ykoath.HmacSha1, ykoath.Totp, 9, key, false))
+	assert.Error(a.Put("algorithm", 0x04, ykoath.Totp, 6, key, false))
+
+	names, err := a.List()
+	require.NoError(err)
+
+	assert.Equal([]*ykoath.Name{
+		{Algorithm: ykoath.HmacSha1, Name: "60/long", Type: ykoath.Totp},
+		{Algorithm: ykoath.HmacSha1, Name: "counter", Type: ykoath.Hotp},
+		{Algorithm: ykoath.HmacSha1, Name: "testvector", Type: ykoath.Totp},
+		{Algorithm: ykoath.HmacSha256, Name: "touchy", Type: ykoath.Totp},
+	}, names)
+
+	callback := func(name string) error {
+		touched = append(touched, name)
+		return nil
+	}
+
+	code, err := a.Calculate("testvector", callback)
+	require.NoError(err)
+	assert.Equal("94287082", code)
+
+	// time step 0 with a period of 60 seconds
+	code, err = a.Calculate("long", callback)
+	require.NoError(err)
+	assert.Equal("84755224", code)
+
+	code, err = a.Calculate("touchy", callback)
+	require.NoError(err)
+	assert.Equal("119246", code)
+	assert.Equal([]string{"touchy"}, touched)
+
+	code, err = a.Calculate("counter", callback)
+	require.NoError(err)
+	assert.Equal("755224", code)
+
+	_, err = a.Calculate("t", callback)
+	assert.True(errors.Is(err, ykoath.ErrMultipleMatches))
+
+	_, err = a.Calculate("missing", callback)
+	assert.True(errors.Is(err, ykoath.ErrUnknownName))
+
+	require.NoError(a.Delete("touchy"))
+	assert.True(errors.Is(a.Delete("touchy"), ykoath.ErrUnknownName))
+
+	require.NoError(a.Close())
+
+	_, err = a.List()
+	assert.Error(err)
+
+	// secrets are encrypted at rest
+	buf, err := os.ReadFile(path)
+	require.NoError(err)
+	assert.NotContains(string(buf), "testvector")
+
+	_, err = Open(path, []byte("wrong"))
+	assert.Error(err)
+
+	// the HOTP counter survives reopening
+	s, err = Open(path, passphrase)
+	require.NoError(err)
+
+	// but is not advanced if it cannot be stored
+	s.path = filepath.Join(path, "missing")
+
+	_, err = s.Calculate("counter", nil)
+	assert.Error(err)
+
+	s.path = path
+
+	code, err = s.Calculate("counter", nil)
+	require.NoError(err)
+	assert.Equal("287082", code)
+
+	names, err = s.List()
+	require.NoError(err)
+	assert.Len(names, 3)
+
+	require.NoError(s.Close())
+
+	// scrypt parameters are bounded before deriving the key
+	for _, params := range [][3]int{
+		{1 << 21, 8, 1},
+		{3 << 10, 8, 1},
+		{1 << 15, 9, 1},
+		{1 << 15, 8, 17},
+		{0, 8, 1},
+	} {
+
+		var f file
+
+		require.NoError(json.Unmarshal(buf, &f))
+
+		f.N, f.R, f.P = params[0], params[1], params[2]
+
+		tampered, err := json.Marshal(&f)
+		require.NoError(err)
+
+		require.NoError(os.WriteFile(path, tampered, 0o600))
+
+		_, err = Open(path, passphrase)
+		assert.ErrorContains(err, "invalid scrypt parameters", params)
+
+	}
+
+}
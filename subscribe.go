@@ -0,0 +1,258 @@
+package ykoath
+
+import (
+	stdcontext "context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	errNothingToRequest  = "update has no code to request"
+	errSubscriptionEnded = "subscription ended"
+
+	subscribeRetry = time.Second
+)
+
+// CodeUpdate is a code emitted by Subscribe. Codes of credentials requiring
+// touch and of HOTP credentials (calculating advances their counter) are
+// pending and have no value until they are requested. Err is set if
+// calculating failed.
+type CodeUpdate struct {
+	Code     *Code
+	Err      error
+	Pending  bool
+	done     <-chan struct{}
+	requests chan<- codeRequest
+}
+
+// codeRequest asks a subscription for the value of a pending code
+type codeRequest struct {
+	name                  string
+	touchRequiredCallback func(string) error
+}
+
+// subscription recomputes codes at the period boundaries of their credentials
+type subscription struct {
+	ctx      stdcontext.Context
+	filter   string
+	oath     *OATH
+	out      chan CodeUpdate
+	queue    []codeRequest
+	requests chan codeRequest
+	windows  map[string]time.Time
+}
+
+// Request asks for the value of a pending code, firing the callback before
+// the device waits for touch. The code is emitted as another update.
+func (u CodeUpdate) Request(touchRequiredCallback func(string) error) error {
+
+	if u.Code == nil || u.requests == nil {
+		return errors.New(errNothingToRequest)
+	}
+
+	select {
+	case u.requests <- codeRequest{u.Code.Name, touchRequiredCallback}:
+		return nil
+	case <-u.done:
+		return errors.New(errSubscriptionEnded)
+	}
+
+}
+
+// Subscribe emits the codes of the credentials matching a query (or of all
+// credentials for an empty query) and recomputes them at the period boundary
+// of each credential, as given by Clock. Credentials with the default period
+// are calculated together with one CALCULATE ALL. Codes are emitted once per
+// window, credentials requiring touch and HOTP credentials as pending. The
+// channel is closed when the context is done; the session must not be used
+// otherwise until then.
+func (o *OATH) Subscribe(ctx stdcontext.Context, filter string) <-chan CodeUpdate {
+
+	s := &subscription{
+		ctx:      ctx,
+		filter:   filter,
+		oath:     o,
+		out:      make(chan CodeUpdate),
+		requests: make(chan codeRequest),
+		windows:  make(map[string]time.Time),
+	}
+
+	go s.run()
+
+	return s.out
+
+}
+
+// run refreshes the codes until the context is done
+func (s *subscription) run() {
+
+	defer close(s.out)
+
+	for {
+
+		next, ok := s.refresh()
+
+		if !ok || !s.wait(next) {
+			return
+		}
+
+	}
+
+}
+
+// refresh emits the codes whose window started since the last refresh and
+// returns the next period boundary (the next default one without TOTP
+// credentials, so credentials added later are seen)
+func (s *subscription) refresh() (time.Time, bool) {
+
+	var (
+		next time.Time
+		now  = s.oath.Clock()
+	)
+
+	res, err := s.oath.calculateAllAt(now)
+
+	if err != nil {
+		return now.Add(subscribeRetry), s.emit(CodeUpdate{Err: err})
+	}
+
+	names := sortedKeys(res)
+
+	if s.filter != "" {
+
+		if names, err = s.oath.match(s.filter, names); err != nil {
+			s.emit(CodeUpdate{Err: err})
+			return time.Time{}, false
+		}
+
+	}
+
+	for _, name := range names {
+
+		var (
+			code = newCode(name, now)
+			err  error
+		)
+
+		switch {
+		case res[name] == touchRequired:
+			code.Touch = true
+		case res[name] == hotpAccount:
+			code = newHOTPCode(name)
+		}
+
+		if code.Type == Totp && (next.IsZero() || code.ValidTo.Before(next)) {
+			next = code.ValidTo
+		}
+
+		if from, ok := s.windows[name]; ok && from.Equal(code.ValidFrom) {
+			continue
+		}
+
+		s.windows[name] = code.ValidFrom
+
+		switch {
+		case code.Touch, code.Type == Hotp:
+		case code.Period != defaultPeriod:
+			code.Value, err = s.oath.calculateAt(name, now)
+		default:
+			code.Value = res[name]
+		}
+
+		if !s.emit(CodeUpdate{Code: code, Err: err, Pending: code.Touch || code.Type == Hotp}) {
+			return next, false
+		}
+
+	}
+
+	if next.IsZero() {
+		next = newCode("", now).ValidTo
+	}
+
+	return next, true
+
+}
+
+// wait serves requests until the next period boundary or the context is done
+func (s *subscription) wait(next time.Time) bool {
+
+	timer := time.NewTimer(next.Sub(s.oath.Clock()))
+	defer timer.Stop()
+
+	for {
+
+		for len(s.queue) > 0 {
+
+			r := s.queue[0]
+			s.queue = s.queue[1:]
+
+			if !s.calculate(r) {
+				return false
+			}
+
+		}
+
+		select {
+		case <-timer.C:
+			return true
+		case r := <-s.requests:
+			s.queue = append(s.queue, r)
+		case <-s.ctx.Done():
+			return false
+		}
+
+	}
+
+}
+
+// calculate emits the value of a requested code
+func (s *subscription) calculate(r codeRequest) bool {
+
+	var (
+		err  error
+		now  = s.oath.Clock()
+		code = newCode(r.name, now)
+	)
+
+	switch s.oath.cache[r.name] {
+	case touchRequired:
+
+		code.Touch = true
+
+		if r.touchRequiredCallback != nil {
+			err = r.touchRequiredCallback(r.name)
+		}
+
+	case hotpAccount:
+		code = newHOTPCode(r.name)
+	}
+
+	if err == nil {
+		code.Value, err = s.oath.calculateAt(r.name, now)
+	}
+
+	return s.emit(CodeUpdate{Code: code, Err: err})
+
+}
+
+// emit sends an update, queueing requests received in the meantime
+func (s *subscription) emit(u CodeUpdate) bool {
+
+	u.done = s.ctx.Done()
+	u.requests = s.requests
+
+	for {
+
+		select {
+		case s.out <- u:
+			return true
+		case r := <-s.requests:
+			s.queue = append(s.queue, r)
+		case <-s.ctx.Done():
+			return false
+		}
+
+	}
+
+}
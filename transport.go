@@ -0,0 +1,47 @@
+package ykoath
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const errReconnectNotSupported = "transport does not support reconnecting"
+
+// Transport exchanges raw APDUs with an OATH applet, e.g. on a remote device.
+// An OATH session is a Transport itself, allowing it to be relayed.
+type Transport interface {
+	Transmit([]byte) ([]byte, error)
+	Close() error
+}
+
+// transportCard adapts a Transport to the card interface
+type transportCard struct {
+	Transport
+}
+
+// NewWithTransport initializes a new OATH session on top of a transport
+func NewWithTransport(t Transport) *OATH {
+
+	return &OATH{
+		card:  &transportCard{t},
+		Clock: time.Now,
+	}
+
+}
+
+// Transmit sends a raw APDU to the card and returns the raw response,
+// including the status word
+func (o *OATH) Transmit(apdu []byte) ([]byte, error) {
+	return o.card.Transmit(apdu)
+}
+
+// Disconnect closes the transport
+func (t *transportCard) Disconnect() error {
+	return t.Close()
+}
+
+// Reconnect is not supported by transports
+func (t *transportCard) Reconnect() error {
+	return errors.New(errReconnectNotSupported)
+}
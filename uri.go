@@ -0,0 +1,255 @@
+package ykoath
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	errInvalidCounter     = "invalid counter (%s)"
+	errInvalidPeriod      = "invalid period (%v)"
+	errInvalidURI         = "invalid otpauth URI"
+	errMissingAccount     = "missing account"
+	errUnsupportedCounter = "counter is only supported for HOTP credentials"
+	errUnsupportedScheme  = "unsupported scheme (%s)"
+)
+
+// CredentialData describes a credential to store, as parsed from an otpauth
+// URI (like ykman's CredentialData)
+type CredentialData struct {
+	Account   string
+	Algorithm Algorithm
+	Counter   uint32
+	Digits    uint8
+	Issuer    string
+	Period    int
+	Secret    []byte
+	Type      Type
+}
+
+// ParseOTPAuthURI parses an otpauth URI as shown in QR codes, e.g.
+// "otpauth://totp/Issuer:account?secret=...&algorithm=SHA256&digits=8&period=60"
+// (https://github.com/google/google-authenticator/wiki/Key-Uri-Format)
+func ParseOTPAuthURI(uri string) (*CredentialData, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidURI)
+	}
+
+	if u.Scheme != "otpauth" {
+		return nil, fmt.Errorf(errUnsupportedScheme, u.Scheme)
+	}
+
+	c := &CredentialData{
+		Algorithm: HmacSha1,
+		Digits:    6,
+		Period:    defaultPeriod,
+	}
+
+	switch strings.ToLower(u.Host) {
+	case "totp":
+		c.Type = Totp
+	case "hotp":
+		c.Type = Hotp
+	default:
+		return nil, fmt.Errorf(errUnsupportedType, u.Host)
+	}
+
+	c.Issuer, c.Account = splitIssuer(strings.TrimPrefix(u.Path, "/"))
+	c.Issuer = strings.TrimSpace(c.Issuer)
+	c.Account = strings.TrimSpace(c.Account)
+
+	if c.Account == "" {
+		return nil, errors.New(errMissingAccount)
+	}
+
+	q := u.Query()
+
+	if issuer := q.Get("issuer"); issuer != "" {
+		c.Issuer = issuer
+	}
+
+	if c.Secret, err = DecodeBase32(q.Get("secret")); err != nil {
+		return nil, err
+	}
+
+	if len(c.Secret) == 0 {
+		return nil, errors.New(errMissingSecret)
+	}
+
+	if v := q.Get("algorithm"); v != "" {
+
+		switch strings.ToUpper(v) {
+		case "SHA1":
+			c.Algorithm = HmacSha1
+		case "SHA256":
+			c.Algorithm = HmacSha256
+		case "SHA512":
+			c.Algorithm = HmacSha512
+		default:
+			return nil, fmt.Errorf(errUnsupportedAlg, v)
+		}
+
+	}
+
+	if v := q.Get("digits"); v != "" {
+
+		digits, err := strconv.Atoi(v)
+
+		if err != nil || digits < 6 || digits > 8 {
+			return nil, fmt.Errorf(errInvalidDigits, v)
+		}
+
+		c.Digits = uint8(digits)
+
+	}
+
+	if v := q.Get("period"); v != "" && c.Type == Totp {
+
+		period, err := strconv.Atoi(v)
+
+		if err != nil || period < 1 {
+			return nil, fmt.Errorf(errInvalidPeriod, v)
+		}
+
+		c.Period = period
+
+	}
+
+	if v := q.Get("counter"); v != "" {
+
+		if c.Type != Hotp {
+			return nil, errors.New(errUnsupportedCounter)
+		}
+
+		counter, err := strconv.ParseUint(v, 10, 32)
+
+		if err != nil {
+			return nil, fmt.Errorf(errInvalidCounter, v)
+		}
+
+		c.Counter = uint32(counter)
+
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+
+}
+
+// Validate checks if the device can store the credential
+func (c *CredentialData) Validate() error {
+
+	if err := validate(c.Algorithm, c.Type, c.Digits); err != nil {
+		return err
+	}
+
+	if c.Type == Totp && c.Period < 1 {
+		return fmt.Errorf(errInvalidPeriod, c.Period)
+	}
+
+	if c.Counter > 0 && c.Type != Hotp {
+		return errors.New(errUnsupportedCounter)
+	}
+
+	if len(c.Secret) == 0 {
+		return errors.New(errMissingSecret)
+	}
+
+	if l := len(c.Name()); l > 64 {
+		return fmt.Errorf(errNametooLong, l)
+	}
+
+	return nil
+
+}
+
+// Name returns the name the credential is stored under on the device
+// ("[period/][issuer:]account", with the period only for non-default TOTP
+// periods)
+func (c *CredentialData) Name() string {
+
+	name := c.Account
+
+	if c.Issuer != "" {
+		name = fmt.Sprintf("%s:%s", c.Issuer, name)
+	}
+
+	if c.Type == Totp && c.Period != defaultPeriod {
+		name = fmt.Sprintf("%d/%s", c.Period, name)
+	}
+
+	return name
+
+}
+
+// URI returns the otpauth URI of the credential, e.g. for enrolling the same
+// secret at a service (see ParseOTPAuthURI)
+func (c *CredentialData) URI() string {
+
+	var (
+		label = c.Account
+		q     = url.Values{}
+		u     = &url.URL{
+			Scheme: "otpauth",
+			Host:   strings.ToLower(c.Type.String()),
+		}
+	)
+
+	if c.Issuer != "" {
+		label = fmt.Sprintf("%s:%s", c.Issuer, c.Account)
+		q.Set("issuer", c.Issuer)
+	}
+
+	q.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(c.Secret))
+	q.Set("algorithm", strings.TrimPrefix(c.Algorithm.String(), "HMAC-"))
+	q.Set("digits", strconv.Itoa(int(c.Digits)))
+
+	if c.Type == Hotp {
+		q.Set("counter", strconv.FormatUint(uint64(c.Counter), 10))
+	} else {
+		q.Set("period", strconv.Itoa(c.Period))
+	}
+
+	u.Path = "/" + label
+	u.RawQuery = q.Encode()
+
+	return u.String()
+
+}
+
+// PutCredential stores a credential under its name, including the initial
+// counter of HOTP credentials
+func (o *OATH) PutCredential(c *CredentialData, touch bool) error {
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	return o.put(c.Name(), c.Algorithm, c.Type, c.Digits, c.Secret, touch, c.Counter)
+
+}
+
+// PutURI parses an otpauth URI and stores the credential it describes, see
+// ParseOTPAuthURI and Put
+func (o *OATH) PutURI(uri string, touch bool) error {
+
+	c, err := ParseOTPAuthURI(uri)
+
+	if err != nil {
+		return err
+	}
+
+	return o.PutCredential(c, touch)
+
+}
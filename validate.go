@@ -0,0 +1,107 @@
+package ykoath
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	errFailedToGenerateChallenge = "failed to generate challenge"
+	errFailedToValidate          = "device response does not match"
+	errWrongPassword             = "wrong password"
+)
+
+// DeriveKey derives the access key of a password, using the name (salt)
+// returned by the "SELECT" instruction
+func DeriveKey(salt, password []byte) []byte {
+	return pbkdf2.Key(password, salt, 1000, 16, sha1.New)
+}
+
+// IsLocked indicates a password protected device that has to be unlocked
+// before use
+func (s *Select) IsLocked() bool {
+	return len(s.Challenge) > 0
+}
+
+// Unlock derives the access key of a password and unlocks the device with it,
+// see UnlockWithKey
+func (o *OATH) Unlock(password []byte) error {
+
+	s, err := o.Select()
+
+	if err != nil {
+		return err
+	}
+
+	return o.unlock(s, DeriveKey(s.Name, password))
+
+}
+
+// UnlockWithKey sends a "VALIDATE" instruction, unlocking a password protected
+// device with an access key (see DeriveKey) and verifying the response of the
+// device. The key is kept for the lifetime of the session, so the device is
+// unlocked again after a reconnect.
+func (o *OATH) UnlockWithKey(key []byte) error {
+
+	s, err := o.Select()
+
+	if err != nil {
+		return err
+	}
+
+	return o.unlock(s, key)
+
+}
+
+// unlock implements the "VALIDATE" instruction for the challenge of a
+// previous "SELECT" instruction
+func (o *OATH) unlock(s *Select, key []byte) error {
+
+	if !s.IsLocked() {
+		o.accessKey = key
+		return nil
+	}
+
+	challenge := make([]byte, 8)
+
+	if _, err := rand.Read(challenge); err != nil {
+		return errors.Wrapf(err, errFailedToGenerateChallenge)
+	}
+
+	res, err := o.send(0x00, 0xa3, 0x00, 0x00,
+		write(0x75, hmacSha1(key, s.Challenge)),
+		write(0x74, challenge),
+	)
+
+	if isStatus(err, 0x6a, 0x80) {
+		return errors.Wrapf(err, errWrongPassword)
+	} else if err != nil {
+		return err
+	}
+
+	for _, tv := range res {
+
+		if tv.tag == 0x75 && hmac.Equal(tv.value, hmacSha1(key, challenge)) {
+			o.accessKey = key
+			return nil
+		}
+
+	}
+
+	return errors.New(errFailedToValidate)
+
+}
+
+// hmacSha1 returns the HMAC-SHA1 of a message
+func hmacSha1(key, message []byte) []byte {
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+
+	return mac.Sum(nil)
+
+}
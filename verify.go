@@ -0,0 +1,90 @@
+package ykoath
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const errInvalidWindow = "invalid window (%d < 0)"
+
+var (
+	// ErrHOTPUnsupported indicates a HOTP credential, whose counter would be
+	// advanced by every calculation
+	ErrHOTPUnsupported = errors.New("HOTP not supported")
+
+	// ErrInvalidCode indicates a code that does not match within the window
+	ErrInvalidCode = errors.New("invalid code")
+
+	// ErrTouchRequired indicates a credential requiring touch, without a
+	// callback to prompt for it
+	ErrTouchRequired = errors.New("touch required")
+)
+
+// Verify checks a code against the matching credential, calculating it for
+// the current time step and up to window time steps before and after it (in
+// that order, alternating between earlier and later steps). It returns the
+// offset of the matching time step, or ErrInvalidCode. Credentials requiring
+// touch are refused with ErrTouchRequired unless a callback is given, which
+// is fired before each calculation. HOTP credentials are refused with
+// ErrHOTPUnsupported.
+func (o *OATH) Verify(name, code string, window int, touchRequiredCallback func(string) error) (int, error) {
+
+	if window < 0 {
+		return 0, errors.Errorf(errInvalidWindow, window)
+	}
+
+	key, err := o.resolve(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if o.cache[key] == hotpAccount {
+		return 0, errors.Wrapf(ErrHOTPUnsupported, "failed to verify %s", key)
+	}
+
+	touch := o.cache[key] == touchRequired
+
+	if touch && touchRequiredCallback == nil {
+		return 0, errors.Wrapf(ErrTouchRequired, "failed to verify %s", key)
+	}
+
+	var (
+		now       = o.Clock()
+		period, _ = splitPeriod(key)
+	)
+
+	for step := 0; step <= 2*window; step++ {
+
+		// 0, -1, 1, -2, 2, ...
+		offset := (step + 1) / 2
+
+		if step%2 == 1 {
+			offset = -offset
+		}
+
+		if touch {
+
+			if err := touchRequiredCallback(name); err != nil {
+				return 0, err
+			}
+
+		}
+
+		value, err := o.calculateAt(key, now.Add(time.Duration(offset*period)*time.Second))
+
+		if err != nil {
+			return 0, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(value), []byte(code)) == 1 {
+			return offset, nil
+		}
+
+	}
+
+	return 0, ErrInvalidCode
+
+}
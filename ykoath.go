@@ -7,16 +7,18 @@ import (
 	"strings"
 	"time"
 
-	"github.com/ebfe/scard"
 	"github.com/pkg/errors"
 )
 
 type card interface {
-	Disconnect(scard.Disposition) error
+	Disconnect() error
+	Reconnect() error
 	Transmit([]byte) ([]byte, error)
 }
 
 type context interface {
+	Connect(string) (card, error)
+	ListReaders() ([]string, error)
 	Release() error
 }
 
@@ -25,10 +27,18 @@ type debugger func(string, ...interface{})
 // OATH implements most parts of the TOTP portion of the YKOATH specification
 // https://developers.yubico.com/OATH/YKOATH_Protocol.html
 type OATH struct {
-	card    card
-	Clock   func() time.Time
-	context context
-	Debug   debugger
+	accessKey  []byte
+	cache      map[string]string
+	cacheTime  time.Time
+	card       card
+	Clock      func() time.Time
+	context    context
+	Debug      debugger
+	Matcher    Matcher
+	Reconnect  Reconnect
+	reader     string
+	recovering bool
+	serial     string
 }
 
 const (
@@ -37,6 +47,7 @@ const (
 	errFailedToEstablishContext   = "failed to establish context"
 	errFailedToListReaders        = "failed to list readers"
 	errFailedToListSuitableReader = "no suitable reader found (out of %d readers)"
+	errFailedToReconnect          = "failed to reconnect to card"
 	errFailedToReleaseContext     = "failed to release context"
 	errFailedToTransmit           = "failed to transmit APDU"
 	errFailedToReadSerial         = "failed to read serial"
@@ -83,7 +94,7 @@ func NewFromSerialList(serialList []string) (*OATH, error) {
 
 // NewSet returns a slice of all Yubikeys on the system
 func NewSet() ([]*OATH, error) {
-	context, err := scard.EstablishContext()
+	context, err := establishContext()
 
 	if err != nil {
 		return []*OATH{}, errors.Wrapf(err, errFailedToEstablishContext)
@@ -102,7 +113,7 @@ func NewSet() ([]*OATH, error) {
 			continue
 		}
 
-		card, err := context.Connect(reader, scard.ShareShared, scard.ProtocolAny)
+		card, err := context.Connect(reader)
 
 		if err != nil {
 			return nil, errors.Wrapf(err, errFailedToConnect)
@@ -112,6 +123,7 @@ func NewSet() ([]*OATH, error) {
 			card:    card,
 			Clock:   time.Now,
 			context: context,
+			reader:  reader,
 		}
 
 		yubikeys = append(yubikeys, &o)
@@ -120,13 +132,75 @@ func NewSet() ([]*OATH, error) {
 	return yubikeys, nil
 }
 
+// ListReaders returns the names of the readers of all Yubikeys on the system,
+// e.g. to detect keys being plugged in or removed
+func ListReaders() ([]string, error) {
+
+	context, err := establishContext()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToEstablishContext)
+	}
+
+	defer context.Release()
+
+	readers, err := context.ListReaders()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToListReaders)
+	}
+
+	var yubikeys []string
+
+	for _, reader := range readers {
+
+		if strings.Contains(strings.ToLower(reader), "yubikey") {
+			yubikeys = append(yubikeys, reader)
+		}
+
+	}
+
+	return yubikeys, nil
+
+}
+
+// NewFromReader creates an OATH session for the key in a reader (as returned
+// by ListReaders), with a context of its own
+func NewFromReader(reader string) (*OATH, error) {
+
+	context, err := establishContext()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, errFailedToEstablishContext)
+	}
+
+	card, err := context.Connect(reader)
+
+	if err != nil {
+		context.Release()
+		return nil, errors.Wrapf(err, errFailedToConnect)
+	}
+
+	return &OATH{
+		card:    card,
+		Clock:   time.Now,
+		context: context,
+		reader:  reader,
+	}, nil
+
+}
+
 // Close terminates an OATH session
 func (o *OATH) Close() error {
 
-	if err := o.card.Disconnect(scard.LeaveCard); err != nil {
+	if err := o.card.Disconnect(); err != nil {
 		return errors.Wrapf(err, errFailedToDisconnect)
 	}
 
+	if o.context == nil {
+		return nil
+	}
+
 	if err := o.context.Release(); err != nil {
 		return errors.Wrapf(err, errFailedToReleaseContext)
 	}
@@ -144,18 +218,46 @@ func (o *OATH) Serial() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if len(resp) < 3 {
+		return "", fmt.Errorf("no serial tag found")
+	}
 	kvs := read(resp[1 : len(resp)-2])
 	for _, item := range kvs {
 		if item.tag == 0x02 {
-			return strconv.FormatUint(uint64(binary.BigEndian.Uint32(item.value)), 10), nil
+			o.serial = strconv.FormatUint(uint64(binary.BigEndian.Uint32(item.value)), 10)
+			return o.serial, nil
 		}
 	}
 	return "", errors.Wrapf(fmt.Errorf("no serial tag found"), errFailedToReleaseContext)
 }
 
-// send sends an APDU to the card
+// send sends an APDU to the card, recovering once from a card reset or
+// removal if the instruction is idempotent and a reconnect policy is set
 func (o *OATH) send(cla, ins, p1, p2 byte, data ...[]byte) (tvs, error) {
 
+	res, err := o.transmit(cla, ins, p1, p2, data...)
+
+	if err != nil && o.retryable(ins, err) {
+
+		if o.Debug != nil {
+			o.Debug("LOST %v", errors.Cause(err))
+		}
+
+		if err := o.recover(); err != nil {
+			return nil, errors.Wrapf(err, errFailedToReconnect)
+		}
+
+		return o.transmit(cla, ins, p1, p2, data...)
+
+	}
+
+	return res, err
+
+}
+
+// transmit sends an APDU to the card, fetching chained responses
+func (o *OATH) transmit(cla, ins, p1, p2 byte, data ...[]byte) (tvs, error) {
+
 	var (
 		code    code
 		results []byte
@@ -1,23 +1,36 @@
 package ykoath
 
 import (
+	"bytes"
+	stdcontext "context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/ebfe/scard"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/yawn/ykoath/internal/hotp"
 )
 
 type testCard struct {
 	mock.Mock
 }
 
-func (t *testCard) Disconnect(d scard.Disposition) error {
-	args := t.Called(d)
+func (t *testCard) Disconnect() error {
+	args := t.Called()
+	return args.Error(0)
+}
+
+func (t *testCard) Reconnect() error {
+	args := t.Called()
 	return args.Error(0)
 }
 
@@ -26,6 +39,349 @@ func (t *testCard) Transmit(b []byte) ([]byte, error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+type testContext struct {
+	mock.Mock
+}
+
+func (t *testContext) Connect(r string) (card, error) {
+	args := t.Called(r)
+	return args.Get(0).(card), args.Error(1)
+}
+
+func (t *testContext) ListReaders() ([]string, error) {
+	args := t.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (t *testContext) Release() error {
+	args := t.Called()
+	return args.Error(0)
+}
+
+// transcriptCard replays recorded responses, counting the APDUs sent
+type transcriptCard struct {
+	responses map[string][][]byte
+	transmits int
+}
+
+func (t *transcriptCard) Disconnect() error {
+	return nil
+}
+
+func (t *transcriptCard) Reconnect() error {
+	return nil
+}
+
+func (t *transcriptCard) Transmit(b []byte) ([]byte, error) {
+
+	t.transmits++
+
+	key := fmt.Sprintf("% x", b)
+
+	if res := t.responses[key]; len(res) > 0 {
+		t.responses[key] = append(res[1:], res[0])
+		return res[0], nil
+	}
+
+	return nil, fmt.Errorf("unexpected APDU %s", key)
+
+}
+
+// newTranscriptCard records the responses of a key with a number of TOTP
+// credentials, chaining the CALCULATE ALL response like the device does
+func newTranscriptCard(credentials int) *transcriptCard {
+
+	var (
+		all        []byte
+		challenge  = write(0x74, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01})
+		code       = write(0x76, []byte{0x06, 0x00, 0x04, 0x61, 0x6a})
+		responses  = make(map[string][][]byte)
+		sendRemain = fmt.Sprintf("% x", []byte{0x00, 0xa5, 0x00, 0x00})
+	)
+
+	for idx := 0; idx < credentials; idx++ {
+
+		name := write(0x71, []byte(fmt.Sprintf("Issuer:account-%02d", idx)))
+		all = append(all, append(name, code...)...)
+
+		calculate := append([]byte{0x00, 0xa2, 0x00, 0x01}, write(0x00, name, challenge)...)
+		responses[fmt.Sprintf("% x", calculate)] = [][]byte{append(code, 0x90, 0x00)}
+
+	}
+
+	calculateAll := fmt.Sprintf("% x", append([]byte{0x00, 0xa4, 0x00, 0x01}, write(0x00, challenge)...))
+
+	for len(all) > 0 {
+
+		chunk := append([]byte(nil), all[:min(len(all), 240)]...)
+		all = all[len(chunk):]
+
+		if len(all) > 0 {
+			chunk = append(chunk, 0x61, byte(min(len(all), 0xff)))
+		} else {
+			chunk = append(chunk, 0x90, 0x00)
+		}
+
+		if len(responses[calculateAll]) == 0 {
+			responses[calculateAll] = [][]byte{chunk}
+		} else {
+			responses[sendRemain] = append(responses[sendRemain], chunk)
+		}
+
+	}
+
+	return &transcriptCard{
+		responses: responses,
+	}
+
+}
+
+// softCard emulates the instructions of a device in software, optionally
+// protected by a password (access key) and corrupting the calculated codes
+type softCard struct {
+	accessKey   []byte
+	corrupt     bool
+	counters    map[string]uint64
+	credentials map[string][]byte
+	unlocked    bool
+}
+
+var (
+	softCardChallenge = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	softCardSalt      = []byte{0x7c, 0x06, 0x60, 0x15, 0x20, 0xfc, 0x3f, 0x8f}
+)
+
+func newSoftCard() *softCard {
+
+	return &softCard{
+		counters:    make(map[string]uint64),
+		credentials: make(map[string][]byte),
+	}
+
+}
+
+func (s *softCard) Disconnect() error {
+	return nil
+}
+
+func (s *softCard) Reconnect() error {
+	return nil
+}
+
+func (s *softCard) Transmit(b []byte) ([]byte, error) {
+
+	var (
+		ok     = []byte{0x90, 0x00}
+		values = make(map[byte][][]byte)
+	)
+
+	// SELECT carries the AID instead of tagged values
+	if b[1] == 0xa4 && b[2] == 0x04 {
+
+		s.unlocked = false
+
+		res := append(write(0x79, []byte{0x05, 0x04, 0x03}), write(0x71, softCardSalt)...)
+
+		if s.accessKey != nil {
+			res = append(res, write(0x74, softCardChallenge)...)
+			res = append(res, 0x7b, 0x01, 0x21)
+		}
+
+		return append(res, ok...), nil
+
+	}
+
+	// RESET and VALIDATE are the only instructions allowed on a locked device
+	if s.accessKey != nil && !s.unlocked && b[1] != 0x04 && b[1] != 0xa3 {
+		return []byte{0x69, 0x82}, nil
+	}
+
+	for data := b[min(len(b), 5):]; len(data) > 0; {
+
+		// the touch property carries no length
+		if data[0] == 0x78 {
+			values[0x78], data = append(values[0x78], data[1:2]), data[2:]
+			continue
+		}
+
+		values[data[0]], data = append(values[data[0]], data[2:2+data[1]]), data[2+data[1]:]
+
+	}
+
+	value := func(tag byte) []byte {
+
+		if len(values[tag]) == 0 {
+			return nil
+		}
+
+		return values[tag][0]
+
+	}
+
+	name := string(value(0x71))
+
+	switch b[1] {
+	case 0x01:
+		s.credentials[name] = value(0x73)
+		s.counters[name] = 0
+
+		if imf := value(0x7a); imf != nil {
+			s.counters[name] = uint64(binary.BigEndian.Uint32(imf))
+		}
+
+	case 0x02:
+		delete(s.credentials, name)
+
+	case 0x03:
+		if key := value(0x73); len(key) == 0 {
+			s.accessKey = nil
+		} else if !bytes.Equal(value(0x75), hmacSha1(key[1:], value(0x74))) {
+			return []byte{0x6a, 0x80}, nil
+		} else {
+			s.accessKey = key[1:]
+			s.unlocked = true
+		}
+
+	case 0x04:
+		s.accessKey = nil
+		s.counters = make(map[string]uint64)
+		s.credentials = make(map[string][]byte)
+
+	case 0x05:
+		to := string(values[0x71][1])
+		s.credentials[to], s.counters[to] = s.credentials[name], s.counters[name]
+		delete(s.credentials, name)
+		delete(s.counters, name)
+
+	case 0xa1:
+		var res []byte
+
+		for _, name := range sortedKeys(s.credentials) {
+			res = append(res, write(0x72, []byte{s.credentials[name][0]}, []byte(name))...)
+		}
+
+		return append(res, ok...), nil
+
+	case 0xa2:
+		credential, ok := s.credentials[name]
+
+		if !ok {
+			return []byte{0x69, 0x84}, nil
+		}
+
+		counter := binary.BigEndian.Uint64(value(0x74))
+
+		if Type(credential[0]&0xf0) == Hotp {
+			counter = s.counters[name]
+			s.counters[name]++
+		}
+
+		truncated := hotp.Truncate(Algorithm(credential[0]&0x0f).Hash(), credential[2:], counter)
+
+		if s.corrupt {
+			truncated++
+		}
+
+		code, _ := strconv.Atoi(hotp.Decimal(truncated, int(credential[1])))
+
+		return append(write(0x76, []byte{credential[1]}, binary.BigEndian.AppendUint32(nil, uint32(code))), 0x90, 0x00), nil
+
+	case 0xa4:
+		var res []byte
+
+		for _, name := range sortedKeys(s.credentials) {
+
+			credential := s.credentials[name]
+			res = append(res, write(0x71, []byte(name))...)
+
+			if Type(credential[0]&0xf0) == Hotp {
+				res = append(res, 0x77, 0x01, credential[1])
+				continue
+			}
+
+			truncated := hotp.Truncate(Algorithm(credential[0]&0x0f).Hash(), credential[2:], binary.BigEndian.Uint64(value(0x74)))
+			code, _ := strconv.Atoi(hotp.Decimal(truncated, int(credential[1])))
+
+			res = append(res, write(0x76, []byte{credential[1]}, binary.BigEndian.AppendUint32(nil, uint32(code)))...)
+
+		}
+
+		return append(res, ok...), nil
+
+	case 0xa3:
+		if s.accessKey == nil || !bytes.Equal(value(0x75), hmacSha1(s.accessKey, softCardChallenge)) {
+			return []byte{0x6a, 0x80}, nil
+		}
+
+		s.unlocked = true
+
+		return append(write(0x75, hmacSha1(s.accessKey, value(0x74))), 0x90, 0x00), nil
+
+	default:
+		return nil, fmt.Errorf("unexpected APDU % x", b)
+	}
+
+	return ok, nil
+
+}
+
+// fullCard rejects new credentials as if the device had no space left
+type fullCard struct {
+	*softCard
+}
+
+func (f *fullCard) Transmit(b []byte) ([]byte, error) {
+
+	if b[1] == 0x01 {
+		return []byte{0x6a, 0x84}, nil
+	}
+
+	return f.softCard.Transmit(b)
+
+}
+
+// timeoutCard fails CALCULATE as if a credential requiring touch had not been
+// touched in time
+type timeoutCard struct {
+	*softCard
+}
+
+func (t *timeoutCard) Transmit(b []byte) ([]byte, error) {
+
+	if b[1] == 0xa2 {
+		return []byte{0x69, 0x85}, nil
+	}
+
+	return t.softCard.Transmit(b)
+
+}
+
+// resetCard fails the first APDU as if another application reset the card
+type resetCard struct {
+	card  *softCard
+	reset bool
+}
+
+func (r *resetCard) Disconnect() error {
+	return nil
+}
+
+func (r *resetCard) Reconnect() error {
+	r.card.unlocked = false
+	return nil
+}
+
+func (r *resetCard) Transmit(b []byte) ([]byte, error) {
+
+	if !r.reset {
+		r.reset = true
+		return nil, errResetCard
+	}
+
+	return r.card.Transmit(b)
+
+}
+
 type vector struct {
 	a          Algorithm
 	digits     uint8
@@ -42,6 +398,67 @@ var (
 	vectors map[string]*vector
 )
 
+func BenchmarkCalculate(b *testing.B) {
+
+	for _, credentials := range []int{1, 10, 30} {
+
+		b.Run(fmt.Sprintf("%d credentials cold", credentials), func(b *testing.B) {
+
+			testCard := newTranscriptCard(credentials)
+
+			for i := 0; i < b.N; i++ {
+
+				client := &OATH{
+					card: testCard,
+					Clock: func() time.Time {
+						return time.Unix(59, 0)
+					},
+				}
+
+				if _, err := client.Calculate("account-00", nil); err != nil {
+					b.Fatal(err)
+				}
+
+			}
+
+			b.ReportMetric(float64(testCard.transmits)/float64(b.N), "apdus/op")
+
+		})
+
+		b.Run(fmt.Sprintf("%d credentials cached", credentials), func(b *testing.B) {
+
+			testCard := newTranscriptCard(credentials)
+
+			client := &OATH{
+				card: testCard,
+				Clock: func() time.Time {
+					return time.Unix(59, 0)
+				},
+			}
+
+			if _, err := client.Calculate("account-00", nil); err != nil {
+				b.Fatal(err)
+			}
+
+			testCard.transmits = 0
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+
+				if _, err := client.Calculate("account-00", nil); err != nil {
+					b.Fatal(err)
+				}
+
+			}
+
+			b.ReportMetric(float64(testCard.transmits)/float64(b.N), "apdus/op")
+
+		})
+
+	}
+
+}
+
 func TestCalculate(t *testing.T) {
 
 	assert := assert.New(t)
@@ -281,19 +698,407 @@ func TestCalculate(t *testing.T) {
 
 }
 
-func TestList(t *testing.T) {
+func TestCalculateAt(t *testing.T) {
+
+	var (
+		calculateAll = func(challenge byte) []byte {
+			return append([]byte{0x00, 0xa4, 0x00, 0x01}, write(0x00, write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, challenge}))...)
+		}
+		calculate = func(name string, challenge byte) []byte {
+			return append([]byte{0x00, 0xa2, 0x00, 0x01}, write(0x00, write(0x71, []byte(name)), write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, challenge}))...)
+		}
+		response = append(append(append(append(append(append(append(append(
+			write(0x71, []byte("60/long")), write(0x76, []byte{0x06, 0x00, 0x04, 0x61, 0x6a})...),
+			write(0x71, []byte("testvector"))...), write(0x76, []byte{0x08, 0x05, 0x9e, 0xb4, 0xea})...),
+			write(0x71, []byte("touchy"))...), 0x7c, 0x01, 0x06),
+			write(0x71, []byte("counter"))...), 0x77, 0x01, 0x06),
+			0x90, 0x00)
+	)
+
+	t.Run("all", func(t *testing.T) {
+
+		var (
+			assert   = assert.New(t)
+			testCard = new(testCard)
+		)
+
+		testCard.
+			On("Transmit", calculateAll(1)).Return(response, nil).Once().
+			On("Transmit", calculate("60/long", 0)).Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0a, 0x96, 0xb0, 0x90, 0x00}, nil).Once()
+
+		client := new(OATH)
+		client.card = testCard
+		client.Clock = time.Now
+
+		res, err := client.CalculateAllAt(time.Unix(59, 0))
+
+		assert.NoError(err)
+		assert.Equal([]*Code{
+			{Name: "60/long", Period: 60, Type: Totp, ValidFrom: time.Unix(0, 0), ValidTo: time.Unix(60, 0), Value: "693936"},
+			{Name: "counter", Type: Hotp},
+			{Name: "testvector", Period: 30, Type: Totp, ValidFrom: time.Unix(30, 0), ValidTo: time.Unix(60, 0), Value: "94287082"},
+			{Name: "touchy", Period: 30, Touch: true, Type: Totp, ValidFrom: time.Unix(30, 0), ValidTo: time.Unix(60, 0)},
+		}, res)
+
+		testCard.AssertExpectations(t)
+
+	})
+
+	t.Run("single", func(t *testing.T) {
+
+		var (
+			assert   = assert.New(t)
+			testCard = new(testCard)
+			touched  bool
+		)
+
+		testCard.
+			On("Transmit", calculateAll(1)).Return(response, nil).Once().
+			On("Transmit", calculate("testvector", 3)).Return([]byte{0x76, 0x05, 0x08, 0x05, 0x9e, 0xb4, 0xea, 0x90, 0x00}, nil).Once().
+			On("Transmit", calculate("touchy", 1)).Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0a, 0x96, 0xb0, 0x90, 0x00}, nil).Once().
+			On("Transmit", calculate("counter", 1)).Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0e, 0x84, 0x6a, 0x90, 0x00}, nil).Once()
+
+		client := new(OATH)
+		client.card = testCard
+		client.Clock = func() time.Time {
+			return time.Unix(59, 0)
+		}
+
+		res, err := client.CalculateAt("testvector", time.Unix(90, 0), nil)
+
+		assert.NoError(err)
+		assert.Equal(&Code{Name: "testvector", Period: 30, Type: Totp, ValidFrom: time.Unix(90, 0), ValidTo: time.Unix(120, 0), Value: "94287082"}, res)
+
+		res, err = client.CalculateAt("touchy", time.Unix(31, 0), func(string) error {
+			touched = true
+			return nil
+		})
+
+		assert.NoError(err)
+		assert.True(touched)
+		assert.Equal("693936", res.Value)
+
+		res, err = client.CalculateAt("counter", time.Unix(31, 0), nil)
+
+		assert.NoError(err)
+		assert.Equal(&Code{Name: "counter", Type: Hotp, Value: "951402"}, res)
+
+		testCard.AssertExpectations(t)
+
+	})
+
+}
+
+func TestCalculateCached(t *testing.T) {
 
 	var (
 		assert   = assert.New(t)
-		testCard = new(testCard)
+		testCard = newTranscriptCard(30)
 	)
 
-	testCard.
-		On(
-			"Transmit",
-			[]byte{
-				0x00, 0xa1, 0x00, 0x00,
-			}).
+	client := &OATH{
+		card: testCard,
+		Clock: func() time.Time {
+			return time.Unix(59, 0)
+		},
+	}
+
+	res, err := client.Calculate("account-17", nil)
+
+	assert.NoError(err)
+	assert.Equal("287082", res)
+	assert.Equal(4, testCard.transmits)
+
+	res, err = client.Calculate("account-17", nil)
+
+	assert.NoError(err)
+	assert.Equal("287082", res)
+	assert.Equal(5, testCard.transmits)
+
+	// a credential deleted by another application
+	testCard.responses[fmt.Sprintf("% x", []byte{
+		0x00, 0xa2, 0x00, 0x01, 0x1d, 0x71, 0x11, 0x49, 0x73, 0x73, 0x75, 0x65,
+		0x72, 0x3a, 0x61, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x2d, 0x31, 0x37,
+		0x74, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	})] = [][]byte{{0x69, 0x84}}
+
+	res, err = client.Calculate("account-17", nil)
+
+	assert.NoError(err)
+	assert.Equal("287082", res)
+	assert.Equal(10, testCard.transmits)
+
+	// a credential added by another application is not in the cache
+	_, err = client.Calculate("account-30", nil)
+
+	assert.ErrorIs(err, ErrUnknownName)
+	assert.Equal(14, testCard.transmits)
+
+	res, err = client.Calculate("account-05", nil)
+
+	assert.NoError(err)
+	assert.Equal("287082", res)
+	assert.Equal(15, testCard.transmits)
+
+	// credentials cached for longer than the TTL are refreshed
+	client.cacheTime = client.cacheTime.Add(-cacheTTL)
+
+	res, err = client.Calculate("account-05", nil)
+
+	assert.NoError(err)
+	assert.Equal("287082", res)
+	assert.Equal(19, testCard.transmits)
+
+}
+
+func TestCalculateSet(t *testing.T) {
+
+	var (
+		calculateAll = []byte{
+			0x00, 0xa4, 0x00, 0x01, 0x0a, 0x74, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x01,
+		}
+		selectOATH = []byte{
+			0x00, 0xa4, 0x04, 0x00, 0x07, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01,
+		}
+		selectOATHResponse = []byte{
+			0x79, 0x03, 0x04, 0x03, 0x03, 0x71, 0x08, 0x7c, 0x06, 0x60, 0x15, 0x20,
+			0xfc, 0x3f, 0x8f, 0x90, 0x00,
+		}
+		testvector = []byte{
+			0x71, 0x0a, 0x74, 0x65, 0x73, 0x74, 0x76, 0x65, 0x63, 0x74, 0x6f, 0x72,
+			0x76, 0x05, 0x08, 0x05, 0x9e, 0xb4, 0xea, 0x90, 0x00,
+		}
+		other = []byte{
+			0x71, 0x05, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x76, 0x05, 0x06, 0x00, 0x04,
+			0x61, 0x6a, 0x90, 0x00,
+		}
+		key = func(serial string, res []byte) *OATH {
+
+			testCard := new(testCard)
+
+			testCard.
+				On("Transmit", selectOATH).Return(selectOATHResponse, nil).Once().
+				On("Transmit", calculateAll).Return(res, nil).Once()
+
+			return &OATH{
+				card: testCard,
+				Clock: func() time.Time {
+					return time.Unix(59, 0)
+				},
+				serial: serial,
+			}
+
+		}
+	)
+
+	t.Run("single key", func(t *testing.T) {
+
+		assert := assert.New(t)
+
+		res, err := CalculateSet([]*OATH{key("1", other), key("2", testvector)}, "testvector", nil)
+
+		assert.NoError(err)
+		assert.Equal(&SetCalculation{Code: "94287082", Name: "testvector", Serial: "2"}, res)
+
+		res, err = CalculateSet([]*OATH{key("1", other), key("2", testvector)}, "oth", nil)
+
+		assert.NoError(err)
+		assert.Equal(&SetCalculation{Code: "287082", Name: "other", Serial: "1"}, res)
+
+	})
+
+	t.Run("period", func(t *testing.T) {
+
+		var (
+			assert = assert.New(t)
+			long   = key("2", append(append(write(0x71, []byte("60/long")), write(0x76, []byte{0x06, 0x00, 0x04, 0x61, 0x6a})...), 0x90, 0x00))
+		)
+
+		long.card.(*testCard).
+			On("Transmit", append([]byte{0x00, 0xa2, 0x00, 0x01}, write(0x00, write(0x71, []byte("60/long")), write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, 0}))...)).
+			Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0a, 0x96, 0xb0, 0x90, 0x00}, nil).Once()
+
+		res, err := CalculateSet([]*OATH{key("1", other), long}, "long", nil)
+
+		assert.NoError(err)
+		assert.Equal(&SetCalculation{Code: "693936", Name: "60/long", Serial: "2"}, res)
+
+		long.card.(*testCard).AssertExpectations(t)
+
+	})
+
+	t.Run("multiple keys", func(t *testing.T) {
+
+		_, err := CalculateSet([]*OATH{key("1", testvector), key("2", testvector)}, "testvector", nil)
+
+		assert.EqualError(t, err, "multiple matches found (testvector on 1,testvector on 2)")
+
+	})
+
+	t.Run("no key", func(t *testing.T) {
+
+		_, err := CalculateSet([]*OATH{key("1", other), key("2", other)}, "testvector", nil)
+
+		assert.EqualError(t, err, "no such name configured (testvector)")
+
+	})
+
+}
+
+func TestCloneSet(t *testing.T) {
+
+	var (
+		credential = &CredentialData{
+			Account:   "me",
+			Algorithm: HmacSha1,
+			Digits:    6,
+			Issuer:    "GitHub",
+			Period:    30,
+			Secret:    []byte("12345678901234567890"),
+			Type:      Totp,
+		}
+		key = func(serial string, c card) *OATH {
+
+			return &OATH{
+				card:   c,
+				Clock:  time.Now,
+				serial: serial,
+			}
+
+		}
+	)
+
+	t.Run("all keys", func(t *testing.T) {
+
+		var (
+			assert  = assert.New(t)
+			primary = newSoftCard()
+			backup  = newSoftCard()
+		)
+
+		results, err := CloneSet([]*OATH{key("1", primary), key("2", backup)}, credential, false)
+
+		assert.NoError(err)
+		assert.Equal([]*CloneResult{
+			{Serial: "1", Written: true},
+			{Serial: "2", Written: true},
+		}, results)
+
+		assert.Contains(primary.credentials, "GitHub:me")
+		assert.Contains(backup.credentials, "GitHub:me")
+
+		_, err = CloneSet([]*OATH{key("1", primary), key("2", newSoftCard())}, credential, false)
+
+		assert.EqualError(err, "failed on key 1: credential GitHub:me already exists")
+
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+
+		var (
+			assert  = assert.New(t)
+			primary = newSoftCard()
+			backup  = newSoftCard()
+			full    = &fullCard{newSoftCard()}
+		)
+
+		results, err := CloneSet([]*OATH{key("1", primary), key("2", backup), key("3", full)}, credential, false)
+
+		sw, _ := StatusWord(err)
+
+		assert.Equal(StatusNoSpace, sw)
+		assert.Len(results, 3)
+		assert.Equal(&CloneResult{Serial: "1", RolledBack: true}, results[0])
+		assert.Equal(&CloneResult{Serial: "2", RolledBack: true}, results[1])
+		assert.Equal("3", results[2].Serial)
+		assert.False(results[2].Written)
+		assert.Error(results[2].Err)
+
+		assert.Empty(primary.credentials)
+		assert.Empty(backup.credentials)
+
+	})
+
+	t.Run("locked key", func(t *testing.T) {
+
+		var (
+			assert  = assert.New(t)
+			primary = newSoftCard()
+			locked  = newSoftCard()
+		)
+
+		locked.accessKey = []byte("secret")
+
+		results, err := CloneSet([]*OATH{key("1", primary), key("2", locked)}, credential, false)
+
+		sw, _ := StatusWord(err)
+
+		assert.Equal(StatusAuthRequired, sw)
+		assert.NoError(results[0].Err)
+		assert.False(results[0].Written)
+		assert.Empty(primary.credentials)
+
+	})
+
+}
+
+func TestFind(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		testCard = new(testCard)
+	)
+
+	testCard.
+		On("Transmit", []byte{0x00, 0xa1, 0x00, 0x00}).
+		Return(
+			[]byte{
+				0x72, 0x0e, 0x21, 0x47, 0x69, 0x74, 0x48, 0x75, 0x62, 0x3a, 0x6d, 0x65,
+				0x40, 0x65, 0x78, 0x61, 0x72, 0x0e, 0x21, 0x47, 0x69, 0x74, 0x4c, 0x61,
+				0x62, 0x3a, 0x6d, 0x65, 0x40, 0x65, 0x78, 0x61, 0x72, 0x0a, 0x22, 0x36,
+				0x30, 0x2f, 0x56, 0x50, 0x4e, 0x3a, 0x6d, 0x65, 0x90, 0x00,
+			},
+			nil,
+		).Twice()
+
+	client := new(OATH)
+	client.card = testCard
+
+	res, err := client.Find("git")
+
+	assert.NoError(err)
+	assert.Equal([]Credential{
+		{Account: "me@exa", Algorithm: HmacSha1, Issuer: "GitHub", Name: "GitHub:me@exa", Period: 30, Type: Totp},
+		{Account: "me@exa", Algorithm: HmacSha1, Issuer: "GitLab", Name: "GitLab:me@exa", Period: 30, Type: Totp},
+	}, res)
+
+	client.Matcher = MatchIssuerAccount
+
+	res, err = client.Find("vpn:ME")
+
+	assert.NoError(err)
+	assert.Equal([]Credential{
+		{Account: "me", Algorithm: HmacSha256, Issuer: "VPN", Name: "60/VPN:me", Period: 60, Type: Totp},
+	}, res)
+
+	testCard.AssertExpectations(t)
+
+}
+
+func TestList(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		testCard = new(testCard)
+	)
+
+	testCard.
+		On(
+			"Transmit",
+			[]byte{
+				0x00, 0xa1, 0x00, 0x00,
+			}).
 		Return(
 			[]byte{
 				0x72, 0x2d, 0x21, 0x74, 0x65, 0x73, 0x74, 0x2d, 0x30, 0x31, 0x2d, 0x31,
@@ -391,6 +1196,336 @@ func TestList(t *testing.T) {
 
 }
 
+func TestMarshalJSON(t *testing.T) {
+
+	var (
+		assert = assert.New(t)
+		from   = time.Unix(1111111080, 0)
+	)
+
+	for _, test := range []struct {
+		Name  string
+		Value interface{}
+		JSON  string
+	}{
+		{
+			"totp name",
+			&Name{Algorithm: HmacSha256, Name: "60/GitHub:me", Type: Totp},
+			`{"account":"me","algorithm":"HMAC-SHA256","issuer":"GitHub","name":"60/GitHub:me","period":60,"type":"TOTP"}`,
+		},
+		{
+			"hotp credential",
+			(&Name{Algorithm: HmacSha1, Name: "counter", Type: Hotp}).Credential(),
+			`{"account":"counter","algorithm":"HMAC-SHA1","name":"counter","type":"HOTP"}`,
+		},
+		{
+			"code",
+			&Code{Name: "me", Period: 30, Type: Totp, ValidFrom: from, ValidTo: from.Add(30 * time.Second), Value: "050471"},
+			`{"name":"me","period":30,"touch":false,"type":"TOTP","valid_from":"2005-03-18T01:58:00Z","valid_to":"2005-03-18T01:58:30Z","value":"050471"}`,
+		},
+		{
+			"code requiring touch",
+			&Code{Name: "me", Period: 30, Touch: true, Type: Totp, ValidFrom: from, ValidTo: from.Add(30 * time.Second)},
+			`{"name":"me","period":30,"touch":true,"type":"TOTP","valid_from":"2005-03-18T01:58:00Z","valid_to":"2005-03-18T01:58:30Z"}`,
+		},
+		{
+			"hotp code",
+			&Code{Name: "counter", Type: Hotp, Value: "755224"},
+			`{"name":"counter","touch":false,"type":"HOTP","value":"755224"}`,
+		},
+		{
+			"select",
+			&Select{Challenge: []byte{0x01}, Name: []byte{0xca, 0xfe}, Version: []byte{5, 4, 3}},
+			`{"id":"cafe","locked":true,"version":"5.4.3"}`,
+		},
+		{
+			"status error",
+			NewErrorInfo(fmt.Errorf("failed to calculate: %w", code{0x69, 0x85})),
+			`{"message":"failed to calculate: touch timeout","status":"touch timeout","status_word":"6985"}`,
+		},
+		{
+			"other error",
+			NewErrorInfo(ErrUnknownName),
+			`{"message":"no such name configured"}`,
+		},
+	} {
+
+		buf, err := json.Marshal(test.Value)
+		assert.NoError(err, test.Name)
+		assert.JSONEq(test.JSON, string(buf), test.Name)
+
+	}
+
+}
+
+func TestMatcher(t *testing.T) {
+
+	names := []string{
+		"GitHub:me",
+		"GitHub:me-too",
+		"GitLab:me",
+		"60/VPN:me",
+		"git",
+	}
+
+	tt := []struct {
+		Name    string
+		Matcher Matcher
+		Query   string
+		Matches []string
+	}{
+		{"exact", MatchExact, "GitHub:me", []string{"GitHub:me"}},
+		{"exact is case sensitive", MatchExact, "github:me", nil},
+		{"substring", MatchSubstring, "git", []string{"GitHub:me", "GitHub:me-too", "GitLab:me", "git"}},
+		{"exact then substring (exact)", MatchExactThenSubstring, "git", []string{"git"}},
+		{"exact then substring (substring)", MatchExactThenSubstring, "hub", []string{"GitHub:me", "GitHub:me-too"}},
+		{"prefix", MatchPrefix, "gitl", []string{"GitLab:me"}},
+		{"prefix ignores period", MatchPrefix, "vpn", []string{"60/VPN:me"}},
+		{"issuer and account", MatchIssuerAccount, "github:ME", []string{"GitHub:me"}},
+		{"issuer and account ignores period", MatchIssuerAccount, "VPN:me", []string{"60/VPN:me"}},
+		{"account without issuer", MatchIssuerAccount, "git", []string{"git"}},
+		{"glob", MatchGlob, "git*:me", []string{"GitHub:me", "GitLab:me"}},
+		{"glob crosses slashes", MatchGlob, "*vpn*", []string{"60/VPN:me"}},
+		{"glob classes", MatchGlob, "Git[!L]??:*", []string{"GitHub:me", "GitHub:me-too"}},
+		{"glob classes with a leading bracket", MatchGlob, "git[]h]ub:*", []string{"GitHub:me", "GitHub:me-too"}},
+		{"glob negated classes with a leading bracket", MatchGlob, "Git[!]H]??:*", []string{"GitLab:me"}},
+		{"regexp", MatchRegexp, "^Git(Hub|Lab):me$", []string{"GitHub:me", "GitLab:me"}},
+	}
+
+	for _, test := range tt {
+		t.Run(test.Name, func(t *testing.T) {
+			matches, err := test.Matcher(test.Query, names)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Matches, matches)
+		})
+	}
+
+	t.Run("invalid regexp", func(t *testing.T) {
+		_, err := MatchRegexp("(", names)
+		assert.Error(t, err)
+	})
+
+}
+
+func TestParseOTPAuthURI(t *testing.T) {
+
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tt := []struct {
+		Name       string
+		URI        string
+		Credential *CredentialData
+		ID         string
+	}{
+		{
+			"defaults",
+			"otpauth://totp/me?secret=" + secret,
+			&CredentialData{Account: "me", Algorithm: HmacSha1, Digits: 6, Period: 30, Secret: []byte("12345678901234567890"), Type: Totp},
+			"me",
+		},
+		{
+			"all parameters",
+			"otpauth://totp/Issuer:me%40example.com?secret=gezdgnbvgy3tqojqgezdgnbvgy3tqojq&algorithm=SHA256&digits=8&period=60",
+			&CredentialData{Account: "me@example.com", Algorithm: HmacSha256, Digits: 8, Issuer: "Issuer", Period: 60, Secret: []byte("12345678901234567890"), Type: Totp},
+			"60/Issuer:me@example.com",
+		},
+		{
+			"issuer parameter",
+			"otpauth://totp/Label:me?issuer=Example%20Inc&secret=" + secret + "&algorithm=sha512",
+			&CredentialData{Account: "me", Algorithm: HmacSha512, Digits: 6, Issuer: "Example Inc", Period: 30, Secret: []byte("12345678901234567890"), Type: Totp},
+			"Example Inc:me",
+		},
+		{
+			"hotp",
+			"otpauth://hotp/Issuer:me?secret=" + secret + "&counter=42&period=60",
+			&CredentialData{Account: "me", Algorithm: HmacSha1, Counter: 42, Digits: 6, Issuer: "Issuer", Period: 30, Secret: []byte("12345678901234567890"), Type: Hotp},
+			"Issuer:me",
+		},
+	}
+
+	for _, test := range tt {
+		t.Run(test.Name, func(t *testing.T) {
+			c, err := ParseOTPAuthURI(test.URI)
+			require.NoError(t, err)
+			assert.Equal(t, test.Credential, c)
+			assert.Equal(t, test.ID, c.Name())
+		})
+	}
+
+	for _, uri := range []string{
+		"https://totp/me?secret=" + secret,
+		"otpauth://motp/me?secret=" + secret,
+		"otpauth://totp/?secret=" + secret,
+		"otpauth://totp/me",
+		"otpauth://totp/me?secret=1234",
+		"otpauth://totp/me?secret=" + secret + "&algorithm=MD5",
+		"otpauth://totp/me?secret=" + secret + "&digits=10",
+		"otpauth://totp/me?secret=" + secret + "&period=0",
+		"otpauth://totp/me?secret=" + secret + "&counter=1",
+		"otpauth://hotp/me?secret=" + secret + "&counter=-1",
+	} {
+		_, err := ParseOTPAuthURI(uri)
+		assert.Error(t, err, uri)
+	}
+
+}
+
+func TestPassword(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		softCard = newSoftCard()
+		client   = &OATH{
+			card: softCard,
+			Clock: func() time.Time {
+				return time.Unix(59, 0)
+			},
+		}
+	)
+
+	require.NoError(client.Put("testvector", HmacSha1, Totp, 8, []byte("12345678901234567890"), false))
+	require.NoError(client.SetPassword([]byte("secret")))
+
+	assert.Equal(DeriveKey(softCardSalt, []byte("secret")), softCard.accessKey)
+
+	// a new session on the locked device
+	client = &OATH{
+		card:  softCard,
+		Clock: client.Clock,
+	}
+
+	s, err := client.Select()
+	require.NoError(err)
+	assert.True(s.IsLocked())
+
+	_, err = client.List()
+	sw, ok := StatusWord(err)
+	assert.True(ok)
+	assert.Equal(StatusAuthRequired, sw)
+
+	err = client.Unlock([]byte("wrong"))
+	sw, _ = StatusWord(err)
+	assert.Equal(StatusWrongSyntax, sw)
+
+	require.NoError(client.Unlock([]byte("secret")))
+
+	code, err := client.Calculate("testvector", nil)
+	require.NoError(err)
+	assert.Equal("94287082", code)
+
+	// the access key survives a reconnect
+	client.Reconnect = ReconnectReader
+	client.card = &resetCard{card: softCard}
+
+	names, err := client.List()
+	require.NoError(err)
+	assert.Len(names, 1)
+
+	require.NoError(client.ClearPassword())
+	assert.Nil(softCard.accessKey)
+
+	_, ok = StatusWord(errors.New("not a status word"))
+	assert.False(ok)
+
+}
+
+func TestProvision(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		softCard = newSoftCard()
+		client   = &OATH{
+			card: softCard,
+			Clock: func() time.Time {
+				return time.Unix(1111111109, 0)
+			},
+		}
+	)
+
+	p, err := client.Provision(ProvisionSpec{
+		Account:   "me",
+		Algorithm: HmacSha256,
+		Digits:    8,
+		Issuer:    "Internal",
+		Period:    60,
+	})
+	require.NoError(err)
+
+	assert.Len(p.Credential.Secret, 32)
+	assert.Contains(softCard.credentials, "60/Internal:me")
+	assert.Equal([]byte{0x89, 0x50, 0x4e, 0x47}, p.QR[:4])
+
+	c, err := ParseOTPAuthURI(p.URI)
+	require.NoError(err)
+	assert.Equal(p.Credential, c)
+
+	p, err = client.Provision(ProvisionSpec{
+		Account:   "counter",
+		Algorithm: HmacSha512,
+		Type:      Hotp,
+	})
+	require.NoError(err)
+
+	assert.Len(p.Credential.Secret, 64)
+	assert.EqualValues(1, p.Credential.Counter)
+	assert.Contains(p.URI, "counter=1")
+	assert.EqualValues(1, softCard.counters["counter"])
+
+	// an existing credential is neither overwritten nor deleted
+	secret := softCard.credentials["counter"]
+
+	_, err = client.Provision(ProvisionSpec{
+		Account: "counter",
+		Type:    Hotp,
+	})
+	assert.EqualError(err, "credential counter already exists")
+	assert.Equal(secret, softCard.credentials["counter"])
+
+	_, err = client.Provision(ProvisionSpec{
+		Account: "touchy",
+		Touch:   true,
+	})
+	assert.True(errors.Is(err, ErrTouchRequired))
+
+	_, err = client.Provision(ProvisionSpec{
+		Account: strings.Repeat("x", 65),
+	})
+	assert.Error(err)
+
+	// credentials failing after they were stored are deleted again
+	_, err = client.Provision(ProvisionSpec{
+		Account: "touchy",
+		Touch:   true,
+		TouchRequiredCallback: func(string) error {
+			return errors.New("canceled")
+		},
+	})
+	assert.EqualError(err, "canceled")
+	assert.NotContains(softCard.credentials, "touchy")
+
+	client.card = &timeoutCard{softCard}
+
+	_, err = client.Provision(ProvisionSpec{
+		Account: "timeout",
+	})
+	assert.ErrorContains(err, "touch timeout")
+	assert.NotContains(softCard.credentials, "timeout")
+
+	client.card = softCard
+	softCard.corrupt = true
+
+	_, err = client.Provision(ProvisionSpec{
+		Account: "corrupt",
+	})
+	assert.Error(err)
+	assert.NotContains(softCard.credentials, "corrupt")
+
+	assert.Len(softCard.credentials, 2)
+
+}
+
 func TestPutAndCalculateTestVector(t *testing.T) {
 
 	tt := []struct {
@@ -538,6 +1673,263 @@ func TestPutAndCalculateTestVector(t *testing.T) {
 	})
 }
 
+func TestPutKeyPreparation(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		softCard = newSoftCard()
+		client   = &OATH{
+			card: softCard,
+			Clock: func() time.Time {
+				return time.Unix(59, 0)
+			},
+		}
+	)
+
+	for _, test := range []struct {
+		Name   string
+		A      Algorithm
+		Key    []byte
+		Length int
+	}{
+		{"short", HmacSha1, []byte("short"), 14},
+		{"regular", HmacSha256, []byte("12345678901234567890123456789012"), 32},
+		{"long", HmacSha1, []byte(strings.Repeat("x", 65)), 20},
+		{"long sha512", HmacSha512, []byte(strings.Repeat("x", 129)), 64},
+		{"block size sha512", HmacSha512, []byte(strings.Repeat("x", 128)), 128},
+	} {
+
+		require.NoError(client.Put(test.Name, test.A, Totp, 6, test.Key, false), test.Name)
+		assert.Len(softCard.credentials[test.Name][2:], test.Length, test.Name)
+
+		// the prepared key results in the same code as the original key
+		code, err := client.calculate(test.Name)
+		require.NoError(err)
+		assert.Equal(hotp.Decimal(hotp.Truncate(test.A.Hash(), test.Key, 1), 6), code, test.Name)
+
+	}
+
+	assert.Error(client.Put("digits", HmacSha1, Totp, 5, []byte("12345678901234567890"), false))
+	assert.Error(client.Put("digits", HmacSha1, Totp, 9, []byte("12345678901234567890"), false))
+	assert.Error(client.Put("algorithm", 0x04, Totp, 6, []byte("12345678901234567890"), false))
+	assert.Error(client.Put("type", HmacSha1, 0x30, 6, []byte("12345678901234567890"), false))
+	assert.Error(client.Put("empty", HmacSha1, Totp, 6, nil, false))
+
+	key, err := DecodeHex("0x31 32:33 34")
+	require.NoError(err)
+	assert.Equal([]byte("1234"), key)
+
+	key, err = DecodeBase32("gezd gnbv")
+	require.NoError(err)
+	assert.Equal([]byte("12345"), key)
+
+	_, err = DecodeHex("xyz")
+	assert.Error(err)
+
+}
+
+func TestPutURI(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		testCard = new(testCard)
+	)
+
+	testCard.
+		On(
+			"Transmit",
+			append([]byte{0x00, 0x01, 0x00, 0x00}, write(0x00,
+				write(0x71, []byte("Issuer:me")),
+				write(0x73, []byte{0x12, 0x08}, []byte("12345678901234567890123456789012")),
+				[]byte{0x78, 0x02},
+				write(0x7a, []byte{0x00, 0x00, 0x00, 0x2a}),
+			)...)).
+		Return(
+			[]byte{
+				0x90, 0x00,
+			},
+			nil,
+		).Once()
+
+	client := new(OATH)
+	client.card = testCard
+
+	assert.NoError(client.PutURI("otpauth://hotp/Issuer:me?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA&algorithm=SHA256&digits=8&counter=42", true))
+
+	assert.Error(client.PutURI("otpauth://totp/"+strings.Repeat("x", 65)+"?secret=GEZDGNBVGY3TQOJQ", false))
+
+	testCard.AssertExpectations(t)
+
+}
+
+func TestReconnect(t *testing.T) {
+
+	var (
+		calculateAll = []byte{
+			0x00, 0xa4, 0x00, 0x01, 0x0a, 0x74, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x01,
+		}
+		calculateAllResponse = []byte{
+			0x71, 0x0a, 0x74, 0x65, 0x73, 0x74, 0x76, 0x65, 0x63, 0x74, 0x6f, 0x72,
+			0x76, 0x05, 0x08, 0x05, 0x9e, 0xb4, 0xea, 0x90, 0x00,
+		}
+		selectOATH = []byte{
+			0x00, 0xa4, 0x04, 0x00, 0x07, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01,
+		}
+		selectOATHResponse = []byte{
+			0x79, 0x03, 0x04, 0x03, 0x03, 0x71, 0x08, 0x7c, 0x06, 0x60, 0x15, 0x20,
+			0xfc, 0x3f, 0x8f, 0x90, 0x00,
+		}
+		selectManagement = []byte{
+			0x00, 0xa4, 0x04, 0x00, 0x08, 0xa0, 0x00, 0x00, 0x05, 0x27, 0x47, 0x11,
+			0x17,
+		}
+		readDeviceInfo = []byte{
+			0x00, 0x1d, 0x00, 0x00,
+		}
+		clock = func() time.Time {
+			return time.Unix(59, 0)
+		}
+	)
+
+	t.Run("reset card", func(t *testing.T) {
+
+		var (
+			assert   = assert.New(t)
+			testCard = new(testCard)
+		)
+
+		testCard.
+			On("Transmit", calculateAll).Return([]byte(nil), errResetCard).Once().
+			On("Reconnect").Return(nil).Once().
+			On("Transmit", selectOATH).Return(selectOATHResponse, nil).Once().
+			On("Transmit", calculateAll).Return(calculateAllResponse, nil).Once()
+
+		client := new(OATH)
+		client.card = testCard
+		client.Clock = clock
+		client.Reconnect = ReconnectReader
+
+		res, err := client.Calculate("testvector", nil)
+
+		assert.NoError(err)
+		assert.Equal("94287082", res)
+
+		testCard.AssertExpectations(t)
+
+	})
+
+	t.Run("removed card without policy", func(t *testing.T) {
+
+		var (
+			assert   = assert.New(t)
+			testCard = new(testCard)
+		)
+
+		testCard.
+			On("Transmit", calculateAll).Return([]byte(nil), errRemovedCard).Once()
+
+		client := new(OATH)
+		client.card = testCard
+		client.Clock = clock
+
+		_, err := client.calculateAll()
+
+		assert.Error(err)
+
+		testCard.AssertExpectations(t)
+
+	})
+
+	t.Run("removed card reconnecting to serial", func(t *testing.T) {
+
+		var (
+			assert      = assert.New(t)
+			removed     = new(testCard)
+			otherKey    = new(testCard)
+			sameKey     = new(testCard)
+			testContext = new(testContext)
+			readers     = []string{
+				"Yubico YubiKey OTP+FIDO+CCID 00 00",
+				"Yubico YubiKey OTP+FIDO+CCID 01 00",
+			}
+		)
+
+		removed.
+			On("Transmit", calculateAll).Return([]byte(nil), errRemovedCard).Once().
+			On("Reconnect").Return(errRemovedCard).Once().
+			On("Disconnect").Return(nil).Once()
+
+		otherKey.
+			On("Transmit", selectManagement).Return([]byte{0x90, 0x00}, nil).Once().
+			On("Transmit", readDeviceInfo).Return([]byte{0x06, 0x02, 0x04, 0x00, 0x00, 0x00, 0x01, 0x90, 0x00}, nil).Once().
+			On("Disconnect").Return(nil).Once()
+
+		sameKey.
+			On("Transmit", selectManagement).Return([]byte{0x90, 0x00}, nil).Once().
+			On("Transmit", readDeviceInfo).Return([]byte{0x06, 0x02, 0x04, 0x00, 0x00, 0x00, 0x02, 0x90, 0x00}, nil).Once().
+			On("Transmit", selectOATH).Return(selectOATHResponse, nil).Once().
+			On("Transmit", calculateAll).Return(calculateAllResponse, nil).Once()
+
+		testContext.
+			On("ListReaders").Return(readers, nil).Once().
+			On("Connect", readers[0]).Return(otherKey, nil).Once().
+			On("Connect", readers[1]).Return(sameKey, nil).Once()
+
+		client := new(OATH)
+		client.card = removed
+		client.context = testContext
+		client.reader = readers[0]
+		client.serial = "2"
+		client.Clock = clock
+		client.Reconnect = ReconnectSerial
+
+		res, err := client.Calculate("testvector", nil)
+
+		assert.NoError(err)
+		assert.Equal("94287082", res)
+		assert.Equal(readers[1], client.reader)
+
+		removed.AssertExpectations(t)
+		otherKey.AssertExpectations(t)
+		sameKey.AssertExpectations(t)
+		testContext.AssertExpectations(t)
+
+	})
+
+}
+
+func TestRenameAndReset(t *testing.T) {
+
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		softCard = newSoftCard()
+		client   = &OATH{
+			card:  softCard,
+			Clock: time.Now,
+		}
+	)
+
+	require.NoError(client.Put("old", HmacSha1, Totp, 6, []byte("12345678901234567890"), false))
+	require.NoError(client.Rename("old", "Issuer:new"))
+
+	names, err := client.List()
+	require.NoError(err)
+	require.Len(names, 1)
+	assert.Equal("Issuer:new", names[0].Name)
+
+	assert.Error(client.Rename("Issuer:new", strings.Repeat("x", 65)))
+
+	require.NoError(client.SetPassword([]byte("secret")))
+	require.NoError(client.Reset())
+
+	assert.Empty(softCard.credentials)
+	assert.Nil(softCard.accessKey)
+
+}
+
 func TestSelectTOTP(t *testing.T) {
 
 	var (
@@ -575,6 +1967,215 @@ func TestSelectTOTP(t *testing.T) {
 
 }
 
+func TestSubscribe(t *testing.T) {
+
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		start        = time.Now()
+		hotpCard     = new(testCard)
+		testCard     = new(testCard)
+		touched      []string
+		calculateAll = func(challenge byte) []byte {
+			return append([]byte{0x00, 0xa4, 0x00, 0x01}, write(0x00, write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, challenge}))...)
+		}
+		calculate = func(name string, challenge byte) []byte {
+			return append([]byte{0x00, 0xa2, 0x00, 0x01}, write(0x00, write(0x71, []byte(name)), write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, challenge}))...)
+		}
+		response = append(append(append(append(append(append(append(append(
+			write(0x71, []byte("60/long")), write(0x76, []byte{0x06, 0x00, 0x04, 0x61, 0x6a})...),
+			write(0x71, []byte("testvector"))...), write(0x76, []byte{0x08, 0x05, 0x9e, 0xb4, 0xea})...),
+			write(0x71, []byte("touchy"))...), 0x7c, 0x01, 0x06),
+			write(0x71, []byte("counter"))...), 0x77, 0x01, 0x06),
+			0x90, 0x00)
+	)
+
+	testCard.
+		On("Transmit", calculateAll(1)).Return(response, nil).Once().
+		On("Transmit", calculate("60/long", 0)).Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0a, 0x96, 0xb0, 0x90, 0x00}, nil).Once().
+		On("Transmit", calculateAll(2)).Return(response, nil).Once().
+		On("Transmit", calculate("60/long", 1)).Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0e, 0x84, 0x6a, 0x90, 0x00}, nil).Once().
+		On("Transmit", calculate("touchy", 2)).Return([]byte{0x76, 0x05, 0x06, 0x00, 0x0a, 0x96, 0xb0, 0x90, 0x00}, nil).Once()
+
+	client := new(OATH)
+	client.card = testCard
+
+	// the first period boundary is 50ms away
+	client.Clock = func() time.Time {
+		return time.Unix(59, 950*int64(time.Millisecond)).Add(time.Since(start))
+	}
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+
+	updates := client.Subscribe(ctx, "")
+
+	next := func() CodeUpdate {
+
+		select {
+		case u, ok := <-updates:
+			require.True(ok)
+			require.NoError(u.Err)
+			return u
+		case <-time.After(5 * time.Second):
+			require.FailNow("no update")
+		}
+
+		return CodeUpdate{}
+
+	}
+
+	for _, expected := range []struct {
+		Name    string
+		Pending bool
+		Value   string
+		ValidTo int64
+	}{
+		{"60/long", false, "693936", 60},
+		{"counter", true, "", 0},
+		{"testvector", false, "94287082", 60},
+		{"touchy", true, "", 60},
+		{"60/long", false, "951402", 120},
+		{"testvector", false, "94287082", 90},
+		{"touchy", true, "", 90},
+	} {
+
+		u := next()
+
+		assert.Equal(expected.Name, u.Code.Name)
+		assert.Equal(expected.Pending, u.Pending, expected.Name)
+		assert.Equal(expected.Value, u.Code.Value, expected.Name)
+
+		if expected.ValidTo > 0 {
+			assert.Equal(time.Unix(expected.ValidTo, 0), u.Code.ValidTo, expected.Name)
+		}
+
+		if expected.Name == "touchy" && expected.ValidTo == 90 {
+
+			require.NoError(u.Request(func(name string) error {
+				touched = append(touched, name)
+				return nil
+			}))
+
+		}
+
+	}
+
+	u := next()
+
+	assert.Equal("touchy", u.Code.Name)
+	assert.False(u.Pending)
+	assert.True(u.Code.Touch)
+	assert.Equal("693936", u.Code.Value)
+	assert.Equal([]string{"touchy"}, touched)
+
+	cancel()
+
+	_, ok := <-updates
+	assert.False(ok)
+
+	assert.Error(u.Request(nil))
+
+	testCard.AssertExpectations(t)
+
+	// without TOTP credentials the codes are refreshed at the default period
+	refreshed := make(chan struct{})
+	signal := func(mock.Arguments) { close(refreshed) }
+
+	hotpCard.
+		On("Transmit", calculateAll(1)).Return(append(write(0x71, []byte("counter")), 0x77, 0x01, 0x06, 0x90, 0x00), nil).Once().
+		On("Transmit", calculateAll(2)).Return([]byte{0x90, 0x00}, nil).Run(signal).Once()
+
+	client.card = hotpCard
+	start = time.Now()
+
+	ctx, cancel = stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+
+	updates = client.Subscribe(ctx, "")
+
+	assert.Equal("counter", next().Code.Name)
+
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		require.FailNow("no refresh")
+	}
+
+	cancel()
+
+	for range updates {
+	}
+
+	hotpCard.AssertExpectations(t)
+
+}
+
+func TestVerify(t *testing.T) {
+
+	var (
+		assert    = assert.New(t)
+		testCard  = new(testCard)
+		calculate = func(name string, challenge byte) []byte {
+			return append([]byte{0x00, 0xa2, 0x00, 0x01}, write(0x00, write(0x71, []byte(name)), write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, challenge}))...)
+		}
+		response = append(append(append(append(append(
+			write(0x71, []byte("testvector")), write(0x76, []byte{0x08, 0x01, 0x9e, 0xb4, 0xea})...),
+			write(0x71, []byte("touchy"))...), 0x7c, 0x01, 0x08),
+			write(0x71, []byte("counter"))...), 0x77, 0x01, 0x06, 0x90, 0x00)
+		touches int
+	)
+
+	testCard.
+		On("Transmit", append([]byte{0x00, 0xa4, 0x00, 0x01}, write(0x00, write(0x74, []byte{0, 0, 0, 0, 0, 0, 0, 2}))...)).Return(response, nil).Once().
+		On("Transmit", calculate("testvector", 2)).Return([]byte{0x76, 0x05, 0x08, 0x01, 0x9e, 0xb4, 0xea, 0x90, 0x00}, nil).Twice().
+		On("Transmit", calculate("testvector", 1)).Return([]byte{0x76, 0x05, 0x08, 0x05, 0x9e, 0xb4, 0xea, 0x90, 0x00}, nil).Once().
+		On("Transmit", calculate("touchy", 2)).Return([]byte{0x76, 0x05, 0x08, 0x01, 0x9e, 0xb4, 0xea, 0x90, 0x00}, nil).Once().
+		On("Transmit", calculate("touchy", 1)).Return([]byte{0x76, 0x05, 0x08, 0x02, 0x9e, 0xb4, 0xea, 0x90, 0x00}, nil).Once().
+		On("Transmit", calculate("touchy", 3)).Return([]byte{0x76, 0x05, 0x08, 0x05, 0x9e, 0xb4, 0xea, 0x90, 0x00}, nil).Once()
+
+	client := new(OATH)
+	client.card = testCard
+	client.Clock = func() time.Time {
+		return time.Unix(89, 0)
+	}
+
+	offset, err := client.Verify("testvector", "94287082", 1, nil)
+
+	assert.NoError(err)
+	assert.Equal(-1, offset)
+
+	_, err = client.Verify("testvector", "94287082", 0, nil)
+
+	assert.ErrorIs(err, ErrInvalidCode)
+
+	_, err = client.Verify("touchy", "94287082", 1, nil)
+
+	assert.ErrorIs(err, ErrTouchRequired)
+
+	// calculating would advance the counter
+	_, err = client.Verify("counter", "755224", 1, nil)
+
+	assert.ErrorIs(err, ErrHOTPUnsupported)
+	testCard.AssertNotCalled(t, "Transmit", calculate("counter", 2))
+
+	offset, err = client.Verify("touchy", "94287082", 1, func(string) error {
+		touches++
+		return nil
+	})
+
+	assert.NoError(err)
+	assert.Equal(1, offset)
+	assert.Equal(3, touches)
+
+	_, err = client.Verify("testvector", "94287082", -1, nil)
+
+	assert.EqualError(err, "invalid window (-1 < 0)")
+
+	testCard.AssertExpectations(t)
+
+}
+
 func init() {
 
 	vectors = map[string]*vector{